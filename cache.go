@@ -0,0 +1,99 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/shurcooL/markdownfmt/markdown"
+)
+
+// fileCache records files that are known to be formatted, by the hash of
+// their content, the markdownfmt executable and the settings they're
+// formatted with, so that they can be skipped.
+type fileCache struct {
+	dir     string
+	version string // Hash of the executable.
+}
+
+// cacheDir returns the directory of the cache, which is $MARKDOWNFMT_CACHE
+// if set, or a directory in the user's cache directory.
+func cacheDir() (string, error) {
+	if dir := os.Getenv("MARKDOWNFMT_CACHE"); dir != "" {
+		return dir, nil
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "markdownfmt"), nil
+}
+
+// openCache opens the cache, creating its directory if needed.
+func openCache() (*fileCache, error) {
+	dir, err := cacheDir()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(exe)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return &fileCache{dir: dir, version: hex.EncodeToString(h.Sum(nil))}, nil
+}
+
+// key returns the key of src formatted with opt and ec.
+func (c *fileCache) key(src []byte, opt markdown.Options, ec editorConfig) string {
+	opt.Report = nil
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%+v\n%q\n", c.version, opt, ec.endOfLine)
+	if ec.finalNewline != nil {
+		fmt.Fprintf(h, "final newline: %v\n", *ec.finalNewline)
+	}
+	h.Write(src)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (c *fileCache) path(key string) string {
+	return filepath.Join(c.dir, key[:2], key)
+}
+
+// formatted reports whether the file with key is known to be formatted.
+func (c *fileCache) formatted(key string) bool {
+	_, err := os.Stat(c.path(key))
+	return err == nil
+}
+
+// add records that the file with key is formatted.
+func (c *fileCache) add(key string) error {
+	path := c.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, nil, 0644)
+}
+
+// removeCache removes the cache.
+func removeCache() error {
+	dir, err := cacheDir()
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(dir)
+}
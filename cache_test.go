@@ -0,0 +1,48 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/shurcooL/markdownfmt/markdown"
+)
+
+func TestFileCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "markdownfmt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer os.Setenv("MARKDOWNFMT_CACHE", os.Getenv("MARKDOWNFMT_CACHE"))
+	os.Setenv("MARKDOWNFMT_CACHE", dir)
+
+	c, err := openCache()
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := []byte("Text.\n")
+	key := c.key(src, markdown.Options{}, editorConfig{})
+	if c.formatted(key) {
+		t.Error("file is formatted before being added")
+	}
+	if err := c.add(key); err != nil {
+		t.Fatal(err)
+	}
+	if !c.formatted(key) {
+		t.Error("file isn't formatted after being added")
+	}
+	if c.formatted(c.key(src, markdown.Options{WrapWidth: 80}, editorConfig{})) {
+		t.Error("file is formatted with other options")
+	}
+	if c.formatted(c.key(src, markdown.Options{}, editorConfig{endOfLine: "crlf"})) {
+		t.Error("file is formatted with other line endings")
+	}
+
+	if err := removeCache(); err != nil {
+		t.Fatal(err)
+	}
+	if c.formatted(key) {
+		t.Error("file is formatted after the cache is removed")
+	}
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/BurntSushi/toml"
+	"github.com/shurcooL/markdownfmt/markdown"
+	"gopkg.in/yaml.v3"
+)
+
+// configNames are the names of configuration files, which are looked for
+// in the directory of each processed file and its parents.
+var configNames = []string{".markdownfmt.yaml", ".markdownfmt.toml"}
+
+// defaultExtensions are the extensions of the files that are processed
+// when walking directories, unless a configuration file sets others.
+var defaultExtensions = []string{".md", ".markdown"}
+
+// config is a configuration file, such as:
+//
+//	root: true
+//	definition-lists: true
+//	max-table-column-width: 40
+//	extensions: [.md, .mdx]
+//	exclude: [vendor/, CHANGELOG.md]
+//
+// The keys of options are the same as in option directives.
+type config struct {
+	path       string
+	root       bool              // Whether configuration files in parent directories are ignored.
+	options    map[string]string // Values of markdown.Options, keyed by their names.
+	extensions []string          // Extensions of files to process, or nil if not set.
+	exclude    []string          // Patterns of paths to skip, as in .gitignore files in the directory of path.
+}
+
+// settings are the settings for processing a file, with configuration files applied.
+type settings struct {
+	options    map[string]string // Values of markdown.Options, keyed by their names.
+	extensions []string
+	exclude    []ignorePattern
+}
+
+// loadConfig reads the configuration file at path.
+// Unknown keys and invalid values are errors.
+func loadConfig(path string) (*config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]interface{})
+	if strings.HasSuffix(path, ".toml") {
+		_, err = toml.Decode(string(data), &values)
+	} else if len(bytes.TrimSpace(data)) != 0 {
+		err = yaml.Unmarshal(data, &values)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	c := &config{path: path, options: make(map[string]string)}
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value := values[key]
+		switch key {
+		case "root":
+			root, ok := value.(bool)
+			if !ok {
+				return nil, fmt.Errorf("%s: invalid value %v for %q", path, value, key)
+			}
+			c.root = root
+		case "extensions":
+			c.extensions, err = stringList(value)
+			if err == nil && c.extensions == nil {
+				c.extensions = []string{}
+			}
+		case "exclude":
+			c.exclude, err = stringList(value)
+		default:
+			v := fmt.Sprint(value)
+			if err := markdown.SetOption(new(markdown.Options), key, v); err != nil {
+				return nil, fmt.Errorf("%s: %v", path, err)
+			}
+			c.options[key] = v
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid value for %q: %v", path, key, err)
+		}
+	}
+	return c, nil
+}
+
+// stringList returns value as a list of strings.
+func stringList(value interface{}) ([]string, error) {
+	values, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("not a list")
+	}
+	var list []string
+	for _, v := range values {
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("%v is not a string", v)
+		}
+		list = append(list, s)
+	}
+	return list, nil
+}
+
+// configs caches the configuration files found in directories,
+// with nil for directories that have none.
+var (
+	configs   = make(map[string]*config)
+	configsMu sync.Mutex
+)
+
+// dirConfig returns the configuration file in dir, if any.
+func dirConfig(dir string) (*config, error) {
+	if c, ok := configs[dir]; ok {
+		return c, nil
+	}
+	var c *config
+	for _, name := range configNames {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		if c != nil {
+			return nil, fmt.Errorf("%s: conflicts with %s", path, c.path)
+		}
+		var err error
+		if c, err = loadConfig(path); err != nil {
+			return nil, err
+		}
+	}
+	configs[dir] = c
+	return c, nil
+}
+
+// settingsFor returns the settings for files in dir. They come from the
+// file given by -config, or else from the configuration files in dir and
+// its parents, up to one with root set, with nearer ones taking precedence.
+func settingsFor(dir string) (settings, error) {
+	configsMu.Lock()
+	defer configsMu.Unlock()
+	var chain []*config // From nearest to farthest.
+	if *configFile != "" {
+		c, ok := configs[*configFile]
+		if !ok {
+			var err error
+			if c, err = loadConfig(*configFile); err != nil {
+				return settings{}, err
+			}
+			configs[*configFile] = c
+		}
+		chain = append(chain, c)
+	} else {
+		dir, err := filepath.Abs(dir)
+		if err != nil {
+			return settings{}, err
+		}
+		for {
+			c, err := dirConfig(dir)
+			if err != nil {
+				return settings{}, err
+			}
+			if c != nil {
+				chain = append(chain, c)
+				if c.root {
+					break
+				}
+			}
+			parent := filepath.Dir(dir)
+			if parent == dir {
+				break
+			}
+			dir = parent
+		}
+	}
+
+	s := settings{options: make(map[string]string), extensions: defaultExtensions}
+	for i := len(chain) - 1; i >= 0; i-- {
+		c := chain[i]
+		for key, value := range c.options {
+			s.options[key] = value
+		}
+		if c.extensions != nil {
+			s.extensions = c.extensions
+		}
+		dir, err := filepath.Abs(filepath.Dir(c.path))
+		if err != nil {
+			return settings{}, err
+		}
+		s.exclude = append(s.exclude, parseIgnorePatterns(dir, c.exclude)...)
+	}
+	return s, nil
+}
+
+// apply sets the options that s has values for.
+func (s settings) apply(opt *markdown.Options) {
+	for key, value := range s.options {
+		markdown.SetOption(opt, key, value) // Validated when loaded.
+	}
+}
+
+// hasExtension reports whether name has one of the extensions of the settings.
+func (s settings) hasExtension(name string) bool {
+	for _, ext := range s.extensions {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+	return false
+}
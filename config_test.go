@@ -0,0 +1,92 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/shurcooL/markdownfmt/markdown"
+)
+
+// writeFiles writes files, keyed by their slash-separated paths relative to dir,
+// creating the directories they're in.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSettingsFor(t *testing.T) {
+	dir, err := ioutil.TempDir("", "markdownfmt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeFiles(t, dir, map[string]string{
+		".markdownfmt.yaml":         "root: true\nmax-table-column-width: 40\npandoc: true\nexclude: [vendor/*]\n",
+		"sub/.markdownfmt.toml":     "pandoc = false\ncompact-tables = true\nextensions = [\".md\", \".mdx\"]\n",
+		"invalid/.markdownfmt.yaml": "line-length: 80\n",
+		"width/.markdownfmt.yaml":   "east-asian-ambiguous-width: 0\n",
+	})
+
+	s, err := settingsFor(filepath.Join(dir, "sub"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var opt markdown.Options
+	s.apply(&opt)
+	if !opt.CompactTables || opt.Pandoc || opt.MaxTableColumnWidth != 40 {
+		t.Errorf("got options %+v, want compact tables and max column width 40 without pandoc", opt)
+	}
+	if want := []string{".md", ".mdx"}; !reflect.DeepEqual(s.extensions, want) {
+		t.Errorf("got extensions %q, want %q", s.extensions, want)
+	}
+	if !ignored(s.exclude, filepath.Join(dir, "vendor", "a.md"), false) || ignored(s.exclude, filepath.Join(dir, "sub", "a.md"), false) {
+		t.Error("vendor/* excludes the wrong files")
+	}
+
+	_, err = settingsFor(filepath.Join(dir, "invalid"))
+	if err == nil || !strings.Contains(err.Error(), `unknown option "line-length"`) {
+		t.Errorf("got error %v, want unknown option", err)
+	}
+
+	_, err = settingsFor(filepath.Join(dir, "width"))
+	if err == nil || !strings.Contains(err.Error(), `invalid value "0" for option "east-asian-ambiguous-width"`) {
+		t.Errorf("got error %v, want invalid value", err)
+	}
+}
+
+func TestReadEditorConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "markdownfmt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	editorconfig := "root = true\n\n[*.md]\nindent_style = space\nindent_size = 2\nmax_line_length = 80\nend_of_line = crlf\ninsert_final_newline = false\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, ".editorconfig"), []byte(editorconfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ec, err := readEditorConfig(filepath.Join(dir, "README.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var opt markdown.Options
+	ec.apply(&opt)
+	if opt.ListIndent != 2 || opt.WrapWidth != 80 {
+		t.Errorf("got list indent %d and wrap width %d, want 2 and 80", opt.ListIndent, opt.WrapWidth)
+	}
+	if got, want := string(ec.lineEndings([]byte("a\n\nb\n"))), "a\r\n\r\nb"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"strconv"
+
+	"github.com/editorconfig/editorconfig-core-go/v2"
+	"github.com/shurcooL/markdownfmt/markdown"
+)
+
+// editorConfig are the settings from .editorconfig files for a file.
+type editorConfig struct {
+	listIndent   *int // Indentation of list items with spaces, or 0 for tabs, if set.
+	wrapWidth    *int // Maximum line length, or 0 for none, if set.
+	endOfLine    string
+	finalNewline *bool // Whether files end with a newline, if set.
+}
+
+// readEditorConfig returns the settings of the .editorconfig files for filename.
+func readEditorConfig(filename string) (editorConfig, error) {
+	def, err := editorconfig.GetDefinitionForFilename(filename)
+	if err != nil {
+		return editorConfig{}, err
+	}
+	var ec editorConfig
+	switch def.IndentStyle {
+	case editorconfig.IndentStyleTab:
+		ec.listIndent = new(int)
+	case editorconfig.IndentStyleSpaces:
+		size, err := strconv.Atoi(def.IndentSize)
+		if err != nil {
+			size = def.TabWidth
+		}
+		if size <= 0 {
+			size = 4
+		}
+		ec.listIndent = &size
+	}
+	switch length := def.Raw["max_line_length"]; length {
+	case "":
+	case "off":
+		ec.wrapWidth = new(int)
+	default:
+		if width, err := strconv.Atoi(length); err == nil {
+			ec.wrapWidth = &width
+		}
+	}
+	ec.endOfLine = def.EndOfLine
+	if v, err := strconv.ParseBool(def.Raw["insert_final_newline"]); err == nil {
+		ec.finalNewline = &v
+	}
+	return ec, nil
+}
+
+// apply sets the options that ec has settings for.
+func (ec editorConfig) apply(opt *markdown.Options) {
+	if ec.listIndent != nil {
+		opt.ListIndent = *ec.listIndent
+	}
+	if ec.wrapWidth != nil {
+		opt.WrapWidth = *ec.wrapWidth
+	}
+}
+
+// lineEndings returns text, which uses "\n" line endings and ends with one,
+// with the line endings and final newline that ec sets.
+func (ec editorConfig) lineEndings(text []byte) []byte {
+	if ec.finalNewline != nil && !*ec.finalNewline {
+		text = bytes.TrimRight(text, "\n")
+	}
+	switch ec.endOfLine {
+	case editorconfig.EndOfLineCrLf:
+		text = bytes.Replace(text, []byte("\n"), []byte("\r\n"), -1)
+	case editorconfig.EndOfLineCr:
+		text = bytes.Replace(text, []byte("\n"), []byte("\r"), -1)
+	}
+	return text
+}
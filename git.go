@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// gitChangedFlag is the value of -git-changed, which can be given
+// without a value, for changes from HEAD, or with a base to compare to.
+type gitChangedFlag struct {
+	set  bool
+	base string
+}
+
+func (f *gitChangedFlag) String() string {
+	if f == nil || !f.set {
+		return ""
+	}
+	return f.base
+}
+
+func (f *gitChangedFlag) Set(value string) error {
+	switch value {
+	case "true":
+		f.set, f.base = true, "HEAD"
+	case "false":
+		f.set, f.base = false, ""
+	default:
+		f.set, f.base = true, value
+	}
+	return nil
+}
+
+func (*gitChangedFlag) IsBoolFlag() bool { return true }
+
+// git runs git in dir, and returns its output.
+func git(dir string, stdin []byte, args ...string) ([]byte, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("git %s: %s", args[0], msg)
+		}
+		return nil, fmt.Errorf("git %s: %v", args[0], err)
+	}
+	return out, nil
+}
+
+// gitTopLevel returns the root directory of the work tree that dir is in.
+func gitTopLevel(dir string) (string, error) {
+	out, err := git(dir, nil, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", err
+	}
+	return filepath.FromSlash(strings.TrimSpace(string(out))), nil
+}
+
+// gitChangedFiles returns the files of the work tree that dir is in that were
+// added or modified since the point where HEAD diverged from base, or are untracked.
+// The files are absolute paths.
+func gitChangedFiles(dir, base string) ([]string, error) {
+	top, err := gitTopLevel(dir)
+	if err != nil {
+		return nil, err
+	}
+	var from []byte
+	if _, err := git(top, nil, "rev-parse", "--verify", "-q", "HEAD"); err != nil {
+		// There are no commits yet, so every file is added.
+		from, err = git(top, []byte{}, "hash-object", "-t", "tree", "--stdin")
+		if err != nil {
+			return nil, err
+		}
+	} else if from, err = git(top, nil, "merge-base", base, "HEAD"); err != nil {
+		return nil, err
+	}
+	changed, err := git(top, nil, "diff", "--name-only", "--diff-filter=ACMR", "-z", strings.TrimSpace(string(from)), "--")
+	if err != nil {
+		return nil, err
+	}
+	untracked, err := git(top, nil, "ls-files", "--others", "--exclude-standard", "-z")
+	if err != nil {
+		return nil, err
+	}
+	return gitPaths(top, changed, untracked), nil
+}
+
+// gitStagedFiles returns the files of the work tree that dir is in that are
+// added or modified in the index. The files are absolute paths.
+func gitStagedFiles(dir string) ([]string, error) {
+	top, err := gitTopLevel(dir)
+	if err != nil {
+		return nil, err
+	}
+	staged, err := git(top, nil, "diff", "--cached", "--name-only", "--diff-filter=ACMR", "-z")
+	if err != nil {
+		return nil, err
+	}
+	return gitPaths(top, staged), nil
+}
+
+// gitPaths returns the NUL-separated paths of lists, relative to top, as sorted absolute paths.
+func gitPaths(top string, lists ...[]byte) []string {
+	var paths []string
+	seen := make(map[string]bool)
+	for _, list := range lists {
+		for _, path := range strings.Split(string(list), "\x00") {
+			if path == "" || seen[path] {
+				continue
+			}
+			seen[path] = true
+			paths = append(paths, filepath.Join(top, filepath.FromSlash(path)))
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// indexPath returns the root directory of the work tree that the file
+// filename is in, and the path of the file relative to it, as in the index.
+func indexPath(filename string) (top, path string, err error) {
+	abs, err := filepath.Abs(filename)
+	if err == nil {
+		// Paths from git have symbolic links resolved.
+		abs, err = filepath.EvalSymlinks(abs)
+	}
+	if err != nil {
+		return "", "", err
+	}
+	if top, err = gitTopLevel(filepath.Dir(abs)); err != nil {
+		return "", "", err
+	}
+	rel, err := filepath.Rel(top, abs)
+	if err != nil {
+		return "", "", err
+	}
+	return top, filepath.ToSlash(rel), nil
+}
+
+// readStaged returns the content of filename in the index.
+func readStaged(filename string) ([]byte, error) {
+	top, path, err := indexPath(filename)
+	if err != nil {
+		return nil, err
+	}
+	return git(top, nil, "cat-file", "blob", ":"+path)
+}
+
+// writeStaged replaces the content of filename in the index with res.
+func writeStaged(filename string, res []byte) error {
+	top, path, err := indexPath(filename)
+	if err != nil {
+		return err
+	}
+	entry, err := git(top, nil, "ls-files", "--stage", "-z", "--", path)
+	if err != nil {
+		return err
+	}
+	mode := strings.Fields(string(entry))
+	if len(mode) == 0 {
+		return fmt.Errorf("%s: not in the index", filename)
+	}
+	hash, err := git(top, res, "hash-object", "-w", "--stdin", "--path", path)
+	if err != nil {
+		return err
+	}
+	_, err = git(top, nil, "update-index", "--cacheinfo", mode[0]+","+strings.TrimSpace(string(hash))+","+path)
+	return err
+}
+
+// gitTasks returns the tasks for the Markdown files in paths (or the current directory)
+// given by -git-changed or -git-staged.
+func gitTasks(paths []string) []task {
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return []task{{err: err}}
+	}
+	// Paths from git have symbolic links resolved.
+	if real, err := filepath.EvalSymlinks(wd); err == nil {
+		wd = real
+	}
+	var tasks []task
+	for _, path := range paths {
+		abs, err := filepath.Abs(path)
+		if err == nil {
+			abs, err = filepath.EvalSymlinks(abs)
+		}
+		if err != nil {
+			tasks = append(tasks, task{err: err})
+			continue
+		}
+		dir := abs
+		if fi, err := os.Stat(abs); err == nil && !fi.IsDir() {
+			dir = filepath.Dir(abs)
+		}
+		var files []string
+		if *gitStaged {
+			files, err = gitStagedFiles(dir)
+		} else {
+			files, err = gitChangedFiles(dir, gitChanged.base)
+		}
+		if err != nil {
+			tasks = append(tasks, task{err: err})
+			continue
+		}
+		for _, file := range files {
+			if file != abs && !strings.HasPrefix(file, abs+string(filepath.Separator)) {
+				continue
+			}
+			s, err := settingsFor(filepath.Dir(file))
+			if err != nil {
+				tasks = append(tasks, task{err: err})
+				continue
+			}
+			name := filepath.Base(file)
+			if strings.HasPrefix(name, ".") || !s.hasExtension(name) {
+				continue
+			}
+			if skip, err := excludedIn(abs, file); err != nil || skip {
+				if err != nil {
+					tasks = append(tasks, task{err: err})
+				}
+				continue
+			}
+			if rel, err := filepath.Rel(wd, file); err == nil {
+				file = rel
+			}
+			tasks = append(tasks, task{filename: file})
+		}
+	}
+	return tasks
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestGitFiles(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+	dir, err := ioutil.TempDir("", "markdownfmt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if dir, err = filepath.EvalSymlinks(dir); err != nil {
+		t.Fatal(err)
+	}
+	run := func(args ...string) {
+		t.Helper()
+		args = append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com", "-c", "commit.gpgsign=false"}, args...)
+		if _, err := git(dir, nil, args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	run("init", "-q")
+	writeFiles(t, dir, map[string]string{"a.md": "a\n", "unchanged.md": "unchanged\n"})
+	run("add", ".")
+	// Before the first commit, every file is added.
+	changed, err := gitChangedFiles(dir, "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{filepath.Join(dir, "a.md"), filepath.Join(dir, "unchanged.md")}; !reflect.DeepEqual(changed, want) {
+		t.Errorf("got changed files %q before the first commit, want %q", changed, want)
+	}
+	run("commit", "-q", "-m", "initial")
+	writeFiles(t, dir, map[string]string{
+		"a.md":     "a changed\n",
+		"b.md":     "b\n",
+		"c.md":     "*   c\n",
+		"sub/d.md": "*   d\n",
+	})
+	run("add", "c.md", "sub/d.md")
+	writeFiles(t, dir, map[string]string{"c.md": "*   c changed\n", "sub/d.md": "*   d changed\n"})
+
+	changed, err = gitChangedFiles(dir, "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{filepath.Join(dir, "a.md"), filepath.Join(dir, "b.md"), filepath.Join(dir, "c.md"), filepath.Join(dir, "sub", "d.md")}; !reflect.DeepEqual(changed, want) {
+		t.Errorf("got changed files %q, want %q", changed, want)
+	}
+	staged, err := gitStagedFiles(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{filepath.Join(dir, "c.md"), filepath.Join(dir, "sub", "d.md")}; !reflect.DeepEqual(staged, want) {
+		t.Errorf("got staged files %q, want %q", staged, want)
+	}
+
+	for _, name := range []string{"c", "sub/d"} {
+		filename := filepath.Join(dir, filepath.FromSlash(name+".md"))
+		src, err := readStaged(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := string(src), "*   "+filepath.Base(name)+"\n"; got != want {
+			t.Errorf("got staged content %q, want %q", got, want)
+		}
+		if err := writeStaged(filename, []byte("- "+filepath.Base(name)+"\n")); err != nil {
+			t.Fatal(err)
+		}
+		src, err = readStaged(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := string(src), "- "+filepath.Base(name)+"\n"; got != want {
+			t.Errorf("got staged content %q after writing, want %q", got, want)
+		}
+		if work, err := ioutil.ReadFile(filename); err != nil || string(work) != "*   "+filepath.Base(name)+" changed\n" {
+			t.Errorf("got work tree content %q, %v, want it unchanged", work, err)
+		}
+	}
+}
+
+func TestGitTasksExcluded(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+	dir, err := ioutil.TempDir("", "markdownfmt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if dir, err = filepath.EvalSymlinks(dir); err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, dir, map[string]string{
+		ignoreFileName:      "vendor/\n",
+		"a.md":              "a\n",
+		"vendor/v.md":       "v\n",
+		"vendor/sub/w.md":   "w\n",
+		"docs/vendor.md":    "d\n",
+		".github/README.md": "r\n",
+	})
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"add", ignoreFileName},
+		{"-c", "user.name=test", "-c", "user.email=test@example.com", "-c", "commit.gpgsign=false", "commit", "-q", "-m", "initial"},
+	} {
+		if _, err := git(dir, nil, args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	defer func(f gitChangedFlag) { gitChanged = f }(gitChanged)
+	gitChanged = gitChangedFlag{set: true, base: "HEAD"}
+	var got []string
+	for _, task := range gitTasks([]string{dir}) {
+		if task.err != nil {
+			t.Fatal(task.err)
+		}
+		abs, err := filepath.Abs(task.filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, abs)
+	}
+	want := []string{filepath.Join(dir, ".github", "README.md"), filepath.Join(dir, "a.md"), filepath.Join(dir, "docs", "vendor.md")}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got files %q, want %q", got, want)
+	}
+}
@@ -1,3 +1,10 @@
 module github.com/shurcooL/markdownfmt
 
-require github.com/russross/blackfriday v1.6.0
+require (
+	github.com/BurntSushi/toml v1.6.0
+	github.com/editorconfig/editorconfig-core-go/v2 v2.1.1
+	github.com/rivo/uniseg v0.4.7
+	github.com/russross/blackfriday v1.6.0
+	gopkg.in/ini.v1 v1.46.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1
+)
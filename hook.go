@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/shurcooL/markdownfmt/markdown"
+)
+
+// commands are the subcommands, which are given as the first argument,
+// keyed by name. They're called with the arguments after the flags.
+var commands = map[string]func(args []string) error{
+	"install-hook": func(args []string) error {
+		if len(args) != 0 {
+			return fmt.Errorf("usage: markdownfmt install-hook")
+		}
+		return installHook(".")
+	},
+	"filter": func(args []string) error {
+		switch len(args) {
+		case 0:
+			return filter("", os.Stdin, os.Stdout)
+		case 1:
+			return filter(args[0], os.Stdin, os.Stdout)
+		}
+		return fmt.Errorf("usage: markdownfmt filter [flags] [path]")
+	},
+}
+
+// preCommitHook is the pre-commit hook written by install-hook.
+// It fails if any staged Markdown file needs formatting.
+const preCommitHook = `#!/bin/sh
+# Installed by markdownfmt install-hook.
+exec markdownfmt -git-staged -check
+`
+
+// installHook writes the pre-commit hook to the hooks directory of the
+// git repository that dir is in. An existing hook that markdownfmt didn't
+// write is left alone.
+func installHook(dir string) error {
+	out, err := git(dir, nil, "rev-parse", "--git-path", "hooks")
+	if err != nil {
+		return err
+	}
+	hooks := filepath.FromSlash(strings.TrimSpace(string(out)))
+	if !filepath.IsAbs(hooks) {
+		hooks = filepath.Join(dir, hooks)
+	}
+	path := filepath.Join(hooks, "pre-commit")
+	if existing, err := ioutil.ReadFile(path); err == nil && !bytes.Contains(existing, []byte("markdownfmt install-hook")) {
+		return fmt.Errorf("%s already exists", path)
+	}
+	if err := os.MkdirAll(hooks, 0755); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(path, []byte(preCommitHook), 0755); err != nil {
+		return err
+	}
+	return os.Chmod(path, 0755) // In case it existed with another mode.
+}
+
+// filter formats in to out, for use as a clean filter in .gitattributes.
+// Settings are looked up for the file filename (git's %f), if not empty.
+// Since a failing filter stops files from being added, in is written
+// unchanged if it can't be formatted.
+func filter(filename string, in io.Reader, out io.Writer) error {
+	src, err := ioutil.ReadAll(in)
+	if err != nil {
+		return err
+	}
+	res, err := filterFormat(filename, src)
+	if err != nil {
+		name := filename
+		if name == "" {
+			name = "<standard input>"
+		}
+		fmt.Fprintf(os.Stderr, "%s: %v (left unformatted)\n", name, err)
+		res = src
+	}
+	_, err = out.Write(res)
+	return err
+}
+
+func filterFormat(filename string, src []byte) (res []byte, err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("%v", e)
+		}
+	}()
+	opt, ec, err := fileOptions(filename, filename == "")
+	if err != nil {
+		return nil, err
+	}
+	res, err = markdown.Process(filename, src, &opt)
+	if err != nil {
+		return nil, err
+	}
+	return ec.lineEndings(res), nil
+}
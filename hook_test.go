@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestInstallHook(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+	dir, err := ioutil.TempDir("", "markdownfmt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if _, err := git(dir, nil, "init", "-q"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := installHook(dir); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, ".git", "hooks", "pre-commit")
+	hook, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(hook) != preCommitHook {
+		t.Errorf("got hook %q, want %q", hook, preCommitHook)
+	}
+	if err := installHook(dir); err != nil {
+		t.Errorf("installing again: %v", err)
+	}
+
+	if err := ioutil.WriteFile(path, []byte("#!/bin/sh\nexit 0\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := installHook(dir); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("got error %v for another hook, want already exists", err)
+	}
+}
+
+func TestFilter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "markdownfmt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeFiles(t, dir, map[string]string{
+		"spaces/.markdownfmt.yaml":  "list-indent: 2\n",
+		"invalid/.markdownfmt.yaml": "line-length: 80\n",
+	})
+
+	tests := []struct {
+		filename string
+		want     string
+	}{
+		{"", "-\ta\n"},
+		{filepath.Join(dir, "spaces", "a.md"), "- a\n"},
+		{filepath.Join(dir, "invalid", "a.md"), "*   a\n"}, // Left unformatted.
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		if err := filter(tt.filename, strings.NewReader("*   a\n"), &out); err != nil {
+			t.Fatal(err)
+		}
+		if got := out.String(); got != tt.want {
+			t.Errorf("filter(%q): got %q, want %q", tt.filename, got, tt.want)
+		}
+	}
+}
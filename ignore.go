@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// ignoreFileName is the name of files that list paths to skip when walking
+// directories, with the syntax of .gitignore files.
+const ignoreFileName = ".markdownfmtignore"
+
+// ignorePattern is a pattern of paths to skip, with the syntax of .gitignore files,
+// matched against paths relative to dir.
+type ignorePattern struct {
+	dir     string
+	re      *regexp.Regexp
+	negate  bool // Whether matching paths are included again.
+	dirOnly bool // Whether the pattern only matches directories.
+}
+
+// parseIgnorePatterns parses the lines of an ignore file in dir.
+// Blank lines and comments are skipped.
+func parseIgnorePatterns(dir string, lines []string) []ignorePattern {
+	var patterns []ignorePattern
+	for _, line := range lines {
+		line = strings.TrimRight(line, " \r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		p := ignorePattern{dir: dir}
+		if strings.HasPrefix(line, "!") {
+			p.negate, line = true, line[1:]
+		} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			p.dirOnly, line = true, strings.TrimRight(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+
+		// A pattern with a slash other than at the end is relative to dir,
+		// others match at any level.
+		var re strings.Builder
+		re.WriteString("^")
+		if strings.Contains(line, "/") {
+			line = strings.TrimPrefix(line, "/")
+		} else {
+			re.WriteString("(.*/)?")
+		}
+		for i := 0; i < len(line); i++ {
+			switch c := line[i]; {
+			case strings.HasPrefix(line[i:], "**/") && (i == 0 || line[i-1] == '/'):
+				re.WriteString("(.*/)?")
+				i += 2
+			case line[i:] == "**" && (i == 0 || line[i-1] == '/'):
+				re.WriteString(".*")
+				i++
+			case c == '*':
+				re.WriteString("[^/]*")
+			case c == '?':
+				re.WriteString("[^/]")
+			case c == '[':
+				end := strings.IndexByte(line[i+1:], ']')
+				if end == -1 {
+					re.WriteString(`\[`)
+					continue
+				}
+				class := line[i+1 : i+1+end]
+				if strings.HasPrefix(class, "!") {
+					class = "^" + class[1:]
+				}
+				re.WriteString("[" + strings.Replace(class, `\`, `\\`, -1) + "]")
+				i += 1 + end
+			case c == '\\' && i+1 < len(line):
+				i++
+				re.WriteString(regexp.QuoteMeta(line[i : i+1]))
+			default:
+				re.WriteString(regexp.QuoteMeta(line[i : i+1]))
+			}
+		}
+		re.WriteString("$")
+		var err error
+		if p.re, err = regexp.Compile(re.String()); err != nil {
+			continue // An invalid pattern never matches.
+		}
+		patterns = append(patterns, p)
+	}
+	return patterns
+}
+
+// match reports whether the pattern matches path, which is absolute.
+func (p ignorePattern) match(path string, isDir bool) bool {
+	if p.dirOnly && !isDir {
+		return false
+	}
+	rel, err := filepath.Rel(p.dir, path)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return false
+	}
+	return p.re.MatchString(filepath.ToSlash(rel))
+}
+
+// ignored reports whether patterns exclude path, which is absolute.
+// The last pattern that matches path decides.
+func ignored(patterns []ignorePattern, path string, isDir bool) bool {
+	ignored := false
+	for _, p := range patterns {
+		if p.negate == ignored && p.match(path, isDir) {
+			ignored = !p.negate
+		}
+	}
+	return ignored
+}
+
+// ignoreFiles caches the patterns of the ignore files with a name
+// in directories and their parents, keyed by name, directory and the
+// farthest parent.
+var ignoreFiles = make(map[[3]string][]ignorePattern)
+
+// ignoreFilePatterns returns the patterns of the ignore files with name in dir,
+// which is absolute, and its parents up to stop, or up to the root of the file
+// system if stop is "", from the farthest to the nearest.
+func ignoreFilePatterns(name, dir, stop string) ([]ignorePattern, error) {
+	if patterns, ok := ignoreFiles[[3]string{name, dir, stop}]; ok {
+		return patterns, nil
+	}
+	var patterns []ignorePattern
+	if parent := filepath.Dir(dir); dir != stop && parent != dir {
+		var err error
+		if patterns, err = ignoreFilePatterns(name, parent, stop); err != nil {
+			return nil, err
+		}
+	}
+	lines, err := readLines(filepath.Join(dir, name))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if len(lines) != 0 {
+		patterns = append(patterns[:len(patterns):len(patterns)], parseIgnorePatterns(dir, lines)...)
+	}
+	ignoreFiles[[3]string{name, dir, stop}] = patterns
+	return patterns, nil
+}
+
+// workTrees caches the roots of the git work trees that directories are in.
+var workTrees = make(map[string]string)
+
+// workTreeRoot returns the root of the git work tree that dir, which is absolute,
+// is in: the nearest of dir and its parents with a .git entry, or "" if there's none.
+func workTreeRoot(dir string) string {
+	if root, ok := workTrees[dir]; ok {
+		return root
+	}
+	root := ""
+	if _, err := os.Lstat(filepath.Join(dir, ".git")); err == nil {
+		root = dir
+	} else if parent := filepath.Dir(dir); parent != dir {
+		root = workTreeRoot(parent)
+	}
+	workTrees[dir] = root
+	return root
+}
+
+func readLines(filename string) ([]string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	return lines, scanner.Err()
+}
+
+// excludePatterns are the patterns given by -exclude flags, relative to the current directory.
+var excludePatterns []ignorePattern
+
+// excluded reports whether path, found when walking root, is to be skipped
+// because of -exclude flags, the exclude patterns of s, .markdownfmtignore files,
+// or .gitignore files with -gitignore. Like git, only the .gitignore files of
+// the work tree that path is in apply, or those under root if it's in none.
+func excluded(root, path string, isDir bool, s settings) (bool, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return false, err
+	}
+	if path, err = filepath.Abs(path); err != nil {
+		return false, err
+	}
+	if ignored(excludePatterns, path, isDir) || ignored(s.exclude, path, isDir) {
+		return true, nil
+	}
+	names := []string{ignoreFileName}
+	if *gitignore {
+		names = append(names, ".gitignore")
+	}
+	for _, name := range names {
+		dir, stop := filepath.Dir(path), ""
+		if name == ".gitignore" {
+			if stop = workTreeRoot(dir); stop == "" {
+				stop = root
+			}
+		}
+		patterns, err := ignoreFilePatterns(name, dir, stop)
+		if err != nil {
+			return false, err
+		}
+		if ignored(patterns, path, isDir) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// excludedIn reports whether path, which is in the directory root, is to be
+// skipped as it would be when walking root: because it or one of the
+// directories between root and it is excluded. root itself is never excluded.
+func excludedIn(root, path string) (bool, error) {
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == "." {
+		return false, err
+	}
+	names := strings.Split(rel, string(filepath.Separator))
+	path = root
+	for i, name := range names {
+		path = filepath.Join(path, name)
+		s, err := settingsFor(filepath.Dir(path))
+		if err != nil {
+			return false, err
+		}
+		if skip, err := excluded(root, path, i < len(names)-1, s); err != nil || skip {
+			return skip, err
+		}
+	}
+	return false, nil
+}
+
+// stringsFlag is a flag that can be given several times.
+type stringsFlag []string
+
+func (f *stringsFlag) String() string { return strings.Join(*f, ",") }
+
+func (f *stringsFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIgnored(t *testing.T) {
+	dir := filepath.FromSlash("/repo")
+	patterns := parseIgnorePatterns(dir, []string{
+		"# Generated documentation.",
+		"node_modules/",
+		"/build",
+		"docs/**/api.md",
+		"*.generated.md",
+		"!keep.generated.md",
+		`\#notes.md`,
+	})
+	tests := []struct {
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{"node_modules", true, true},
+		{"web/node_modules", true, true},
+		{"web/node_modules", false, false},
+		{"build", true, true},
+		{"web/build", true, false},
+		{"docs/api.md", false, true},
+		{"docs/v1/ref/api.md", false, true},
+		{"api.md", false, false},
+		{"a/b.generated.md", false, true},
+		{"a/keep.generated.md", false, false},
+		{"#notes.md", false, true},
+		{"README.md", false, false},
+	}
+	for _, tc := range tests {
+		path := filepath.Join(dir, filepath.FromSlash(tc.path))
+		if got := ignored(patterns, path, tc.isDir); got != tc.want {
+			t.Errorf("ignored(%q, isDir: %v) = %v, want %v", tc.path, tc.isDir, got, tc.want)
+		}
+	}
+}
+
+// Test that .gitignore files outside the work tree, or outside the walked
+// directory when it's in none, don't apply.
+func TestGitignoreScope(t *testing.T) {
+	defer func(v bool) { *gitignore = v }(*gitignore)
+	*gitignore = true
+
+	dir, err := ioutil.TempDir("", "markdownfmt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeFiles(t, dir, map[string]string{
+		".gitignore":           "ignored.md\n",
+		"repo/.git":            "gitdir: elsewhere\n",
+		"repo/docs/.gitignore": "ignored.md\n",
+		"plain/.gitignore":     "ignored.md\n",
+	})
+	tests := []struct {
+		root, path string
+		want       bool
+	}{
+		{"repo", "repo/a/ignored.md", false},
+		{"repo", "repo/docs/ignored.md", true},
+		{"repo/docs", "repo/docs/ignored.md", true},
+		{"plain", "plain/docs/ignored.md", true},
+		{"plain/docs", "plain/docs/ignored.md", false},
+	}
+	for _, tc := range tests {
+		root := filepath.Join(dir, filepath.FromSlash(tc.root))
+		path := filepath.Join(dir, filepath.FromSlash(tc.path))
+		if got, err := excluded(root, path, false, settings{}); err != nil || got != tc.want {
+			t.Errorf("excluded(%q, %q) = %v, %v, want %v", tc.root, tc.path, got, err, tc.want)
+		}
+	}
+}
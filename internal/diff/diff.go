@@ -0,0 +1,273 @@
+// Package diff computes line-based differences between texts,
+// and formats them as unified diffs.
+package diff
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// Options control how a unified diff is written.
+type Options struct {
+	Context int  // Number of unchanged lines around each change.
+	Color   bool // Whether to color the diff with ANSI escape codes.
+
+	// Words makes changes be written as the changed lines of the new text,
+	// with the words that were deleted and inserted marked as [-old-]{+new+}
+	// (or colored, without the brackets).
+	Words bool
+}
+
+// ANSI escape codes used for Options.Color.
+const (
+	bold  = "\x1b[1m"
+	red   = "\x1b[31m"
+	green = "\x1b[32m"
+	cyan  = "\x1b[36m"
+	reset = "\x1b[0m"
+)
+
+// Unified returns a unified diff of old and new, labeled "a/"+oldName and "b/"+newName
+// (without a leading slash of the names). It returns nil if old and new are equal.
+func Unified(oldName, newName string, old, new []byte, opt Options) []byte {
+	if bytes.Equal(old, new) {
+		return nil
+	}
+	context := opt.Context
+	if context < 0 {
+		context = 0
+	}
+	edits := Lines(old, new)
+
+	var out bytes.Buffer
+	header := fmt.Sprintf("--- a/%s\n+++ b/%s\n", strings.TrimPrefix(oldName, "/"), strings.TrimPrefix(newName, "/"))
+	writeColored(&out, header, bold, opt.Color)
+	for i := 0; i < len(edits); {
+		for i < len(edits) && edits[i].Op == Equal {
+			i++
+		}
+		if i == len(edits) {
+			break
+		}
+
+		// Extend the hunk over changes separated by at most 2*context unchanged lines.
+		start, end := i-context, i
+		if start < 0 {
+			start = 0
+		}
+		for {
+			for end < len(edits) && edits[end].Op != Equal {
+				end++
+			}
+			next := end
+			for next < len(edits) && edits[next].Op == Equal {
+				next++
+			}
+			if next < len(edits) && next-end <= 2*context {
+				end = next
+				continue
+			}
+			end += context
+			if end > next {
+				end = next
+			}
+			break
+		}
+		writeHunk(&out, edits[start:end], opt)
+		i = end
+	}
+	return out.Bytes()
+}
+
+// writeHunk writes a hunk of edits, including its header.
+func writeHunk(out *bytes.Buffer, edits []Edit, opt Options) {
+	var oldCount, newCount int
+	for _, e := range edits {
+		if e.Op != Insert {
+			oldCount++
+		}
+		if e.Op != Delete {
+			newCount++
+		}
+	}
+	header := fmt.Sprintf("@@ -%s +%s @@\n", hunkRange(edits[0].Old, oldCount), hunkRange(edits[0].New, newCount))
+	writeColored(out, header, cyan, opt.Color)
+	if opt.Words {
+		writeWordHunk(out, edits, opt.Color)
+		return
+	}
+	for _, e := range edits {
+		line := string(e.Op) + e.Line
+		if !strings.HasSuffix(line, "\n") {
+			line += "\n\\ No newline at end of file\n"
+		}
+		switch e.Op {
+		case Delete:
+			writeColored(out, line, red, opt.Color)
+		case Insert:
+			writeColored(out, line, green, opt.Color)
+		default:
+			out.WriteString(line)
+		}
+	}
+}
+
+// writeColored writes text, colored line by line if color is set.
+func writeColored(out *bytes.Buffer, text, code string, color bool) {
+	writeMarked(out, text, "", "", code, color)
+}
+
+// hunkRange formats the range of count lines starting at index start
+// for a hunk header. An empty range is given by the line before it.
+func hunkRange(start, count int) string {
+	switch count {
+	case 0:
+		return fmt.Sprintf("%d,0", start)
+	case 1:
+		return fmt.Sprintf("%d", start+1)
+	default:
+		return fmt.Sprintf("%d,%d", start+1, count)
+	}
+}
+
+// Op is the kind of an edit, given by its prefix in a unified diff.
+type Op byte
+
+const (
+	Equal  Op = ' '
+	Delete Op = '-'
+	Insert Op = '+'
+)
+
+// Edit is a line that's kept, deleted from the old text, or inserted into the new text.
+type Edit struct {
+	Op   Op
+	Line string // Line, including its terminating newline, if any.
+	Old  int    // Index of the line in the old text, or of the next line there for an insertion.
+	New  int    // Index of the line in the new text, or of the next line there for a deletion.
+}
+
+// Lines returns a shortest edit script that turns old into new, line by line,
+// using Myers' algorithm. Deletions come before insertions in each change.
+func Lines(old, new []byte) []Edit {
+	return shortestEdits(splitLines(old), splitLines(new))
+}
+
+// shortestEdits returns a shortest edit script that turns a into b.
+func shortestEdits(a, b []string) []Edit {
+	n, m := len(a), len(b)
+	max := n + m
+	offset := max + 1
+	v := make([]int, 2*max+3)
+
+	// trace[d] holds v[-d:d+1] as it was at the start of step d,
+	// for recovering the path once the end is reached.
+	var trace [][]int
+	var x, y int
+search:
+	for d := 0; d <= max; d++ {
+		trace = append(trace, append([]int(nil), v[offset-d:offset+d+1]...))
+		for k := -d; k <= d; k += 2 {
+			if k == -d || k != d && v[offset+k-1] < v[offset+k+1] {
+				x = v[offset+k+1] // Move down: insertion.
+			} else {
+				x = v[offset+k-1] + 1 // Move right: deletion.
+			}
+			y = x - k
+			for x < n && y < m && a[x] == b[y] {
+				x, y = x+1, y+1
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				break search
+			}
+		}
+	}
+
+	// Walk the path back from the end.
+	var edits []Edit
+	for d := len(trace) - 1; d >= 0; d-- {
+		prev := func(k int) int { return trace[d][k+d] }
+		k := x - y
+		var prevK int
+		if k == -d || k != d && prev(k-1) < prev(k+1) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := 0
+		if d > 0 {
+			prevX = prev(prevK)
+		}
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x, y = x-1, y-1
+			edits = append(edits, Edit{Op: Equal, Line: a[x]})
+		}
+		if d == 0 {
+			break
+		}
+		if x == prevX {
+			edits = append(edits, Edit{Op: Insert, Line: b[prevY]})
+		} else {
+			edits = append(edits, Edit{Op: Delete, Line: a[prevX]})
+		}
+		x, y = prevX, prevY
+	}
+	for i, j := 0, len(edits)-1; i < j; i, j = i+1, j-1 {
+		edits[i], edits[j] = edits[j], edits[i]
+	}
+	return group(edits)
+}
+
+// group moves the deletions of each change before its insertions,
+// and sets the line indices of edits.
+func group(edits []Edit) []Edit {
+	grouped := make([]Edit, 0, len(edits))
+	var oldIndex, newIndex int
+	add := func(e Edit) {
+		e.Old, e.New = oldIndex, newIndex
+		if e.Op != Insert {
+			oldIndex++
+		}
+		if e.Op != Delete {
+			newIndex++
+		}
+		grouped = append(grouped, e)
+	}
+	for i := 0; i < len(edits); {
+		if edits[i].Op == Equal {
+			add(edits[i])
+			i++
+			continue
+		}
+		end := i
+		for end < len(edits) && edits[end].Op != Equal {
+			end++
+		}
+		for _, op := range []Op{Delete, Insert} {
+			for _, e := range edits[i:end] {
+				if e.Op == op {
+					add(e)
+				}
+			}
+		}
+		i = end
+	}
+	return grouped
+}
+
+// splitLines splits text into lines, each including its terminating newline.
+func splitLines(text []byte) []string {
+	var lines []string
+	for len(text) > 0 {
+		end := bytes.IndexByte(text, '\n') + 1
+		if end == 0 {
+			end = len(text)
+		}
+		lines = append(lines, string(text[:end]))
+		text = text[end:]
+	}
+	return lines
+}
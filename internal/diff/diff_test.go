@@ -0,0 +1,186 @@
+package diff_test
+
+import (
+	"bytes"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/shurcooL/markdownfmt/internal/diff"
+)
+
+func TestUnified(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, new string
+		context  int
+		want     string
+	}{
+		{
+			name: "equal",
+			old:  "a\nb\n",
+			new:  "a\nb\n",
+			want: "",
+		},
+		{
+			name:    "change",
+			old:     "a\nb\nc\nd\ne\n",
+			new:     "a\nb\nC\nd\ne\n",
+			context: 1,
+			want: `--- a/f
++++ b/f
+@@ -2,3 +2,3 @@
+ b
+-c
++C
+ d
+`,
+		},
+		{
+			name:    "separate hunks",
+			old:     "1\n2\n3\n4\n5\n6\n7\n8\n",
+			new:     "0\n1\n2\n3\n4\n5\n6\n7\n",
+			context: 1,
+			want: `--- a/f
++++ b/f
+@@ -1 +1,2 @@
++0
+ 1
+@@ -7,2 +8 @@
+ 7
+-8
+`,
+		},
+		{
+			name:    "merged hunks",
+			old:     "1\n2\n3\n4\n5\n",
+			new:     "0\n1\n2\n3\n4\n",
+			context: 2,
+			want: `--- a/f
++++ b/f
+@@ -1,5 +1,5 @@
++0
+ 1
+ 2
+ 3
+ 4
+-5
+`,
+		},
+		{
+			name:    "no newline at end of file",
+			old:     "a\nb",
+			new:     "a\nb\n",
+			context: 3,
+			want: `--- a/f
++++ b/f
+@@ -1,2 +1,2 @@
+ a
+-b
+\ No newline at end of file
++b
+`,
+		},
+		{
+			name:    "empty",
+			old:     "",
+			new:     "a\n",
+			context: 3,
+			want: `--- a/f
++++ b/f
+@@ -0,0 +1 @@
++a
+`,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := string(diff.Unified("f", "f", []byte(tc.old), []byte(tc.new), diff.Options{Context: tc.context}))
+			if got != tc.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestUnifiedWords(t *testing.T) {
+	old := "Title\n\nThe quick brown fox\njumps over the dog.\n"
+	new := "Title\n\nThe quick red fox jumps over the lazy dog.\n"
+	got := string(diff.Unified("f", "f", []byte(old), []byte(new), diff.Options{Context: 1, Words: true}))
+	want := `--- a/f
++++ b/f
+@@ -2,3 +2,2 @@
+
+The quick [-brown-]{+red+} fox
+{+ +}jumps over the {+lazy +}dog.
+`
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	got = string(diff.Unified("f", "f", []byte(old), []byte(new), diff.Options{Context: 0, Words: true, Color: true}))
+	want = "\x1b[1m--- a/f\x1b[0m\n\x1b[1m+++ b/f\x1b[0m\n\x1b[36m@@ -3,2 +3 @@\x1b[0m\n" +
+		"The quick \x1b[31mbrown\x1b[0m\x1b[32mred\x1b[0m fox\n\x1b[32m \x1b[0mjumps over the \x1b[32mlazy \x1b[0mdog.\n"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+// Test that applying the edit script of random texts to the old text gives the new one,
+// and that the script is as short as the one found by diff, if it's available.
+func TestLines(t *testing.T) {
+	diffPath, _ := exec.LookPath("diff")
+	dir := t.TempDir()
+	r := rand.New(rand.NewSource(1))
+	randomText := func() []byte {
+		var lines []string
+		for i := r.Intn(20); i > 0; i-- {
+			lines = append(lines, string(rune('a'+r.Intn(4)))+"\n")
+		}
+		return []byte(strings.Join(lines, ""))
+	}
+	for i := 0; i < 500; i++ {
+		old, new := randomText(), randomText()
+		edits := diff.Lines(old, new)
+		var gotOld, gotNew bytes.Buffer
+		changes := 0
+		for _, e := range edits {
+			if e.Op != diff.Insert {
+				gotOld.WriteString(e.Line)
+			}
+			if e.Op != diff.Delete {
+				gotNew.WriteString(e.Line)
+			}
+			if e.Op != diff.Equal {
+				changes++
+			}
+		}
+		if gotOld.String() != string(old) || gotNew.String() != string(new) {
+			t.Fatalf("edits of %q to %q give %q to %q", old, new, gotOld.String(), gotNew.String())
+		}
+
+		if diffPath == "" {
+			continue
+		}
+		oldFile, newFile := filepath.Join(dir, "old"), filepath.Join(dir, "new")
+		if err := os.WriteFile(oldFile, old, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(newFile, new, 0644); err != nil {
+			t.Fatal(err)
+		}
+		out, _ := exec.Command(diffPath, "--minimal", oldFile, newFile).Output()
+		want := 0
+		for _, line := range strings.Split(string(out), "\n") {
+			if strings.HasPrefix(line, "< ") || strings.HasPrefix(line, "> ") {
+				want++
+			}
+		}
+		if changes != want {
+			t.Errorf("%d changes from %q to %q, want %d", changes, old, new, want)
+		}
+	}
+}
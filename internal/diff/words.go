@@ -0,0 +1,97 @@
+package diff
+
+import (
+	"bytes"
+	"strings"
+)
+
+// writeWordHunk writes the edits of a hunk with changes marked word by word.
+// Unchanged lines are written as they are, without a prefix.
+func writeWordHunk(out *bytes.Buffer, edits []Edit, color bool) {
+	for i := 0; i < len(edits); {
+		if edits[i].Op == Equal {
+			out.WriteString(withNewline(edits[i].Line))
+			i++
+			continue
+		}
+		var old, new strings.Builder
+		for ; i < len(edits) && edits[i].Op != Equal; i++ {
+			if edits[i].Op == Delete {
+				old.WriteString(edits[i].Line)
+			} else {
+				new.WriteString(edits[i].Line)
+			}
+		}
+		var line bytes.Buffer
+		for _, e := range joinEdits(shortestEdits(splitWords(old.String()), splitWords(new.String()))) {
+			switch e.Op {
+			case Equal:
+				line.WriteString(e.Line)
+			case Delete:
+				writeMarked(&line, e.Line, "[-", "-]", red, color)
+			case Insert:
+				writeMarked(&line, e.Line, "{+", "+}", green, color)
+			}
+		}
+		out.WriteString(withNewline(line.String()))
+	}
+}
+
+// writeMarked writes text between the start and end markers, or colored if color is set,
+// leaving the newlines in text outside of them.
+func writeMarked(out *bytes.Buffer, text, start, end, code string, color bool) {
+	if color {
+		start, end = code, reset
+	}
+	for text != "" {
+		part := text
+		if i := strings.IndexByte(text, '\n'); i != -1 {
+			part = text[:i]
+		}
+		text = text[len(part):]
+		if part != "" {
+			out.WriteString(start + part + end)
+		}
+		if text != "" {
+			out.WriteByte('\n')
+			text = text[1:]
+		}
+	}
+}
+
+// joinEdits joins adjacent edits of the same kind.
+func joinEdits(edits []Edit) []Edit {
+	var joined []Edit
+	for _, e := range edits {
+		if n := len(joined); n > 0 && joined[n-1].Op == e.Op {
+			joined[n-1].Line += e.Line
+			continue
+		}
+		joined = append(joined, e)
+	}
+	return joined
+}
+
+// splitWords splits text into words, runs of spaces and tabs, and newlines.
+func splitWords(text string) []string {
+	var words []string
+	for text != "" {
+		end := 1
+		if text[0] != '\n' {
+			space := text[0] == ' ' || text[0] == '\t'
+			for end < len(text) && text[end] != '\n' && (text[end] == ' ' || text[end] == '\t') == space {
+				end++
+			}
+		}
+		words = append(words, text[:end])
+		text = text[end:]
+	}
+	return words
+}
+
+func withNewline(s string) string {
+	if strings.HasSuffix(s, "\n") {
+		return s
+	}
+	return s + "\n"
+}
@@ -9,21 +9,50 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"runtime"
 	"strings"
+	"sync"
 
+	"github.com/shurcooL/markdownfmt/internal/diff"
 	"github.com/shurcooL/markdownfmt/markdown"
 	"golang.org/x/term"
 )
 
 var (
 	// Main operation modes.
-	list   = flag.Bool("l", false, "list files whose formatting differs from markdownfmt's")
-	write  = flag.Bool("w", false, "write result to (source) file instead of stdout")
-	doDiff = flag.Bool("d", false, "display diffs instead of rewriting files")
+	list        = flag.Bool("l", false, "list files whose formatting differs from markdownfmt's")
+	write       = flag.Bool("w", false, "write result to (source) file instead of stdout")
+	doDiff      = flag.Bool("d", false, "display diffs instead of rewriting files")
+	backup      = flag.String("backup", "", "with -w, keep the original of each changed file with `suffix` added to its name")
+	diffContext = flag.Int("U", 3, "number of context lines in diffs")
+	wordDiff    = flag.Bool("word-diff", false, "mark changed words rather than lines in diffs")
+	jobs        = flag.Int("j", runtime.GOMAXPROCS(0), "number of files to process in parallel")
+	useCache    = flag.Bool("cache", false, "skip files known to be formatted, using a cache of their hashes")
+	clearCache  = flag.Bool("clear-cache", false, "remove the cache of -cache before processing files")
+	format      = flag.String("format", "", "report files that need formatting and diagnostics in `format`: json, sarif, github or checkstyle (implies -l unless -w is set)")
+	check       = flag.Bool("check", false, "exit with status 1 if any file needs formatting (implies -l unless -d or -w is set)")
+
+	useEditorConfig = flag.Bool("editorconfig", true, "apply the indentation, line length and line ending settings of .editorconfig files")
+	gitignore       = flag.Bool("gitignore", false, "skip files and directories ignored by .gitignore files when walking directories")
+	configFile      = flag.String("config", "", "use the configuration file `path` instead of looking for "+strings.Join(configNames, " or ")+" files")
+
+	// Table import.
+	csvInput = flag.Bool("csv", false, "read CSV with a header row and write it as a Markdown table")
+	tsvInput = flag.Bool("tsv", false, "like -csv, but for tab-separated values")
+	align    = flag.String("align", "", "column alignment for -csv and -tsv, one of l, c, r or - per column (e.g., \"l-r\")")
 
 	exitCode = 0
+
+	cache *fileCache // Cache of formatted files, if -cache is set.
+
+	excludeFlag stringsFlag
+	gitChanged  gitChangedFlag
+	gitStaged   = flag.Bool("git-staged", false, "process only Markdown files staged in git, reading them from (and with -w, writing them to) the index")
+
+	// Counts of files processed, and of those whose formatting has changed, for -check.
+	checkedFiles, changedFiles int
+	countsMu                   sync.Mutex
 )
 
 func report(err error) {
@@ -31,60 +60,141 @@ func report(err error) {
 	exitCode = 2
 }
 
+// reportDiagnostic prints a problem found in filename that doesn't prevent it from being formatted.
+func reportDiagnostic(w io.Writer, filename string, d markdown.Diagnostic) {
+	if d.Line == 0 {
+		fmt.Fprintf(w, "%s: %s\n", filename, d.Message)
+		return
+	}
+	fmt.Fprintf(w, "%s:%d: %s\n", filename, d.Line, d.Message)
+}
+
+// isTerminal reports whether standard output is a terminal that supports escape codes.
+func isTerminal() bool {
+	return term.IsTerminal(int(os.Stdout.Fd())) && os.Getenv("TERM") != "dumb"
+}
+
 func usage() {
 	fmt.Fprintf(os.Stderr, "usage: markdownfmt [flags] [path ...]\n")
+	fmt.Fprintf(os.Stderr, "       markdownfmt install-hook\n")
+	fmt.Fprintf(os.Stderr, "       markdownfmt filter [flags] [path]\n")
 	flag.PrintDefaults()
 }
 
-func isMarkdownFile(f os.FileInfo) bool {
+func isMarkdownFile(f os.FileInfo, s settings) bool {
 	// Ignore non-Markdown files.
 	name := f.Name()
-	return !f.IsDir() && !strings.HasPrefix(name, ".") && (strings.HasSuffix(name, ".md") || strings.HasSuffix(name, ".markdown"))
+	return !f.IsDir() && !strings.HasPrefix(name, ".") && s.hasExtension(name)
 }
 
-func processFile(filename string, in io.Reader, out io.Writer, stdin bool) error {
-	if in == nil {
-		f, err := os.Open(filename)
-		if err != nil {
-			return err
+// fileOptions returns the options for formatting the file filename, from
+// configuration files and .editorconfig files, which aren't used for stdin.
+func fileOptions(filename string, stdin bool) (markdown.Options, editorConfig, error) {
+	var opt markdown.Options
+	var ec editorConfig
+	dir := filepath.Dir(filename)
+	if stdin {
+		dir = "."
+	}
+	s, err := settingsFor(dir)
+	if err != nil {
+		return opt, ec, err
+	}
+	if *useEditorConfig && !stdin {
+		if ec, err = readEditorConfig(filename); err != nil {
+			return opt, ec, err
 		}
-		defer f.Close()
-		in = f
 	}
+	ec.apply(&opt)
+	s.apply(&opt)
+	return opt, ec, nil
+}
 
-	src, err := ioutil.ReadAll(in)
+// processFile processes the file filename, or in if it isn't nil,
+// writing its output to out and diagnostics to errOut.
+// It may be called concurrently for different files.
+func processFile(filename string, in io.Reader, out, errOut io.Writer, stdin bool) error {
+	opt, ec, err := fileOptions(filename, stdin)
 	if err != nil {
 		return err
 	}
 
-	isTerminal := func() bool {
-		return term.IsTerminal(int(os.Stdout.Fd())) && os.Getenv("TERM") != "dumb"
+	var src []byte
+	switch {
+	case in != nil:
+		src, err = ioutil.ReadAll(in)
+	case *gitStaged:
+		src, err = readStaged(filename)
+	default:
+		src, err = ioutil.ReadFile(filename)
 	}
-	res, err := markdown.Process(filename, src, &markdown.Options{
-		Terminal: !*list && !*write && !*doDiff && isTerminal(),
-	})
 	if err != nil {
 		return err
 	}
 
-	if !bytes.Equal(src, res) {
+	opt.Terminal = !*list && !*write && !*doDiff && isTerminal()
+	var key string
+	if cache != nil && !opt.Terminal {
+		key = cache.key(src, opt, ec)
+	}
+	var res []byte
+	if key != "" && cache.formatted(key) {
+		res = src
+	} else {
+		var diagnostics []markdown.Diagnostic
+		opt.Report = func(d markdown.Diagnostic) {
+			diagnostics = append(diagnostics, d)
+			if *format == "" {
+				reportDiagnostic(errOut, filename, d)
+			}
+		}
+		res, err = markdown.Process(filename, src, &opt)
+		if err != nil {
+			return err
+		}
+		res = ec.lineEndings(res)
+		if *format != "" {
+			addReport(filename, src, res, diagnostics)
+		}
+		// Files with diagnostics aren't cached, so that they're reported again.
+		if key != "" && diagnostics == nil && (bytes.Equal(src, res) || *write) {
+			if err := cache.add(cache.key(res, opt, ec)); err != nil {
+				return err
+			}
+		}
+	}
+
+	changed := !bytes.Equal(src, res)
+	countsMu.Lock()
+	checkedFiles++
+	if changed {
+		changedFiles++
+	}
+	countsMu.Unlock()
+	if changed {
 		// formatting has changed
-		if *list {
+		if *list && *format == "" {
 			fmt.Fprintln(out, filename)
 		}
-		if *write {
-			err = ioutil.WriteFile(filename, res, 0)
-			if err != nil {
+		if *write && *gitStaged {
+			if err := writeStaged(filename, res); err != nil {
 				return err
 			}
 		}
-		if *doDiff {
-			data, err := diff(src, res)
-			if err != nil {
-				return fmt.Errorf("computing diff: %s", err)
+		// With -git-staged, the file is only written if it has no unstaged changes.
+		if *write && (!*gitStaged || fileEquals(filename, src)) {
+			if err := writeFile(filename, res); err != nil {
+				return err
 			}
-			fmt.Printf("diff %s markdownfmt/%s\n", filename, filename)
-			out.Write(data)
+		}
+		if *doDiff {
+			name := strings.TrimPrefix(filepath.ToSlash(filename), "/")
+			fmt.Fprintf(out, "diff a/%s b/%s\n", name, name)
+			out.Write(diff.Unified(name, name, src, res, diff.Options{
+				Context: *diffContext,
+				Color:   isTerminal(),
+				Words:   *wordDiff,
+			}))
 		}
 	}
 
@@ -95,18 +205,124 @@ func processFile(filename string, in io.Reader, out io.Writer, stdin bool) error
 	return err
 }
 
-func visitFile(path string, f os.FileInfo, err error) error {
-	if err == nil && isMarkdownFile(f) {
-		err = processFile(path, nil, os.Stdout, false)
+// fileEquals reports whether the file filename has the content data.
+func fileEquals(filename string, data []byte) bool {
+	current, err := ioutil.ReadFile(filename)
+	return err == nil && bytes.Equal(current, data)
+}
+
+// processTable converts CSV or TSV from in (or the file filename if in is nil)
+// to a Markdown table, and writes it to out.
+func processTable(filename string, in io.Reader, out io.Writer) error {
+	if in == nil {
+		f, err := os.Open(filename)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	csvOpt := &markdown.CSVOptions{Align: *align}
+	if *tsvInput {
+		csvOpt.Comma = '\t'
+	}
+	res, err := markdown.CSVTable(in, csvOpt, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %v", filename, err)
+	}
+	_, err = out.Write(res)
+	return err
+}
+
+// task is a file to process, or an error found while looking for files.
+type task struct {
+	filename string
+	err      error
+}
+
+// visitFile adds path to tasks if it's a Markdown file that isn't excluded,
+// and skips excluded directories, when walking root.
+func visitFile(root, path string, f os.FileInfo, err error, tasks *[]task) error {
+	if err != nil {
+		*tasks = append(*tasks, task{err: err})
+		return nil
+	}
+	if path == root {
+		return nil
+	}
+	s, err := settingsFor(filepath.Dir(path))
+	if err != nil {
+		// Don't format the rest of the directory with the wrong settings.
+		*tasks = append(*tasks, task{err: err})
+		return filepath.SkipDir
 	}
+	skip, err := excluded(root, path, f.IsDir(), s)
 	if err != nil {
-		report(err)
+		*tasks = append(*tasks, task{err: err})
+		return nil
+	}
+	if f.IsDir() {
+		if skip {
+			return filepath.SkipDir
+		}
+		return nil
+	}
+	if isMarkdownFile(f, s) && !skip {
+		*tasks = append(*tasks, task{filename: path})
 	}
 	return nil
 }
 
-func walkDir(path string) {
-	filepath.Walk(path, visitFile)
+func walkDir(root string, tasks *[]task) {
+	filepath.Walk(root, func(path string, f os.FileInfo, err error) error {
+		return visitFile(root, path, f, err, tasks)
+	})
+}
+
+// runTasks processes the files of tasks, up to -j at a time, and writes their
+// output and errors in the order of tasks.
+func runTasks(tasks []task) {
+	type result struct {
+		out, errOut bytes.Buffer
+		err         error
+		done        chan struct{}
+	}
+	results := make([]result, len(tasks))
+	for i := range results {
+		results[i].done = make(chan struct{})
+	}
+	go func() {
+		n := *jobs
+		if n < 1 {
+			n = 1
+		}
+		workers := make(chan struct{}, n)
+		for i, t := range tasks {
+			r := &results[i]
+			if t.err != nil {
+				r.err = t.err
+				close(r.done)
+				continue
+			}
+			workers <- struct{}{}
+			go func(filename string) {
+				defer func() { <-workers }()
+				r.err = processFile(filename, nil, &r.out, &r.errOut, false)
+				close(r.done)
+			}(t.filename)
+		}
+	}()
+
+	for i := range results {
+		r := &results[i]
+		<-r.done
+		os.Stdout.Write(r.out.Bytes())
+		os.Stderr.Write(r.errOut.Bytes())
+		if r.err != nil {
+			report(r.err)
+		}
+	}
 }
 
 func main() {
@@ -114,58 +330,111 @@ func main() {
 	// so that it can use defer and have them
 	// run before the exit.
 	markdownfmtMain()
+	if *check {
+		fmt.Fprintf(os.Stderr, "%d of %d files checked need formatting\n", changedFiles, checkedFiles)
+		if exitCode == 0 && changedFiles > 0 {
+			exitCode = 1
+		}
+	}
 	os.Exit(exitCode)
 }
 
 func markdownfmtMain() {
+	flag.Var(&gitChanged, "git-changed", "process only Markdown files added or modified in git since the merge base with `base` (HEAD if not given), or untracked")
+	flag.Var(&excludeFlag, "exclude", "skip files and directories matching `pattern`, as in .gitignore files, when walking directories (can be repeated)")
 	flag.Usage = usage
+	if len(os.Args) > 1 && commands[os.Args[1]] != nil {
+		flag.CommandLine.Parse(os.Args[2:]) // Exits on error.
+		if err := commands[os.Args[1]](flag.Args()); err != nil {
+			report(err)
+		}
+		return
+	}
 	flag.Parse()
 
-	if flag.NArg() == 0 {
-		if err := processFile("<standard input>", os.Stdin, os.Stdout, true); err != nil {
+	if len(excludeFlag) != 0 {
+		dir, err := os.Getwd()
+		if err != nil {
 			report(err)
+			return
 		}
-		return
+		excludePatterns = parseIgnorePatterns(dir, excludeFlag)
 	}
 
-	for i := 0; i < flag.NArg(); i++ {
-		path := flag.Arg(i)
-		switch dir, err := os.Stat(path); {
-		case err != nil:
+	if *check && !*doDiff && !*write {
+		*list = true
+	}
+
+	if *clearCache {
+		if err := removeCache(); err != nil {
 			report(err)
-		case dir.IsDir():
-			walkDir(path)
-		default:
-			if err := processFile(path, nil, os.Stdout, false); err != nil {
+			return
+		}
+		if flag.NArg() == 0 && !*useCache {
+			return
+		}
+	}
+	if *useCache {
+		var err error
+		if cache, err = openCache(); err != nil {
+			report(err)
+			return
+		}
+	}
+
+	if *csvInput || *tsvInput {
+		if flag.NArg() == 0 {
+			if err := processTable("<standard input>", os.Stdin, os.Stdout); err != nil {
 				report(err)
 			}
+			return
 		}
+		for i := 0; i < flag.NArg(); i++ {
+			if err := processTable(flag.Arg(i), nil, os.Stdout); err != nil {
+				report(err)
+			}
+		}
+		return
 	}
-}
 
-func diff(b1, b2 []byte) (data []byte, err error) {
-	f1, err := ioutil.TempFile("", "markdownfmt")
-	if err != nil {
-		return
+	if *format != "" {
+		if reportFormats[*format] == nil {
+			report(fmt.Errorf("unknown report format %q", *format))
+			return
+		}
+		if *doDiff {
+			report(fmt.Errorf("-format can't be used with -d"))
+			return
+		}
+		if !*write {
+			*list = true
+		}
+		defer writeReport(os.Stdout)
 	}
-	defer os.Remove(f1.Name())
-	defer f1.Close()
 
-	f2, err := ioutil.TempFile("", "markdownfmt")
-	if err != nil {
+	if flag.NArg() == 0 && !gitChanged.set && !*gitStaged {
+		if err := processFile("<standard input>", os.Stdin, os.Stdout, os.Stderr, true); err != nil {
+			report(err)
+		}
 		return
 	}
-	defer os.Remove(f2.Name())
-	defer f2.Close()
 
-	f1.Write(b1)
-	f2.Write(b2)
+	if gitChanged.set || *gitStaged {
+		runTasks(gitTasks(flag.Args()))
+		return
+	}
 
-	data, err = exec.Command("diff", "-u", f1.Name(), f2.Name()).CombinedOutput()
-	if len(data) > 0 {
-		// diff exits with a non-zero status when the files don't match.
-		// Ignore that failure as long as we get output.
-		err = nil
+	var tasks []task
+	for i := 0; i < flag.NArg(); i++ {
+		path := flag.Arg(i)
+		switch dir, err := os.Stat(path); {
+		case err != nil:
+			tasks = append(tasks, task{err: err})
+		case dir.IsDir():
+			walkDir(path, &tasks)
+		default:
+			tasks = append(tasks, task{filename: path})
+		}
 	}
-	return
+	runTasks(tasks)
 }
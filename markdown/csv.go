@@ -0,0 +1,95 @@
+package markdown
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// CSVOptions specifies how CSVTable reads its input.
+type CSVOptions struct {
+	// Comma is the field delimiter. Zero means ','. Use '\t' for TSV.
+	Comma rune
+
+	// Align specifies the alignment of the columns, one character per column:
+	// 'l' for left, 'c' for center, 'r' for right and '-' for none.
+	// Columns past the end of Align have no alignment.
+	Align string
+}
+
+// CSVTable reads CSV records from r, the first of which is the header row,
+// and returns them as a Markdown table formatted as Process formats tables.
+// If csvOpt or opt is nil the defaults are used.
+func CSVTable(r io.Reader, csvOpt *CSVOptions, opt *Options) ([]byte, error) {
+	if csvOpt == nil {
+		csvOpt = &CSVOptions{}
+	}
+	cr := csv.NewReader(r)
+	if csvOpt.Comma != 0 {
+		cr.Comma = csvOpt.Comma
+	}
+	if cr.Comma == '\t' {
+		cr.LazyQuotes = true
+	}
+	cr.FieldsPerRecord = -1 // Ragged rows are padded or truncated like in Markdown tables.
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, errors.New("no header row")
+	}
+
+	var src bytes.Buffer
+	writeTableRow(&src, records[0])
+	var delimiters []string
+	for column := range records[0] {
+		var align byte = '-'
+		if column < len(csvOpt.Align) {
+			align = csvOpt.Align[column]
+		}
+		switch align {
+		case 'l':
+			delimiters = append(delimiters, ":--")
+		case 'c':
+			delimiters = append(delimiters, ":-:")
+		case 'r':
+			delimiters = append(delimiters, "--:")
+		case '-':
+			delimiters = append(delimiters, "---")
+		default:
+			return nil, fmt.Errorf("invalid alignment %q for column %d", align, column+1)
+		}
+	}
+	fmt.Fprintf(&src, "|%s|\n", strings.Join(delimiters, "|"))
+	for _, record := range records[1:] {
+		writeTableRow(&src, record)
+	}
+	return Process("", src.Bytes(), opt)
+}
+
+// cellEscaper escapes the characters of plain text that Markdown would
+// otherwise parse as a column separator or as inline markup in a table cell.
+var cellEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	"|", `\|`,
+	"`", "\\`",
+	"*", `\*`,
+	"_", `\_`,
+	"[", `\[`,
+	"]", `\]`,
+	"<", `\<`,
+	">", `\>`,
+)
+
+// writeTableRow writes a table row with the given cells of plain text.
+func writeTableRow(w *bytes.Buffer, cells []string) {
+	for _, cell := range cells {
+		cell = strings.Join(strings.Fields(cell), " ")
+		fmt.Fprintf(w, "| %s ", cellEscaper.Replace(cell))
+	}
+	w.WriteString("|\n")
+}
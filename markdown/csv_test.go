@@ -0,0 +1,91 @@
+package markdown_test
+
+import (
+	"log"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/shurcooL/markdownfmt/markdown"
+)
+
+func ExampleCSVTable() {
+	input := `Name,Description,Stars
+markdownfmt,"Like gofmt, but for Markdown.",400
+mdfmt,Fork with front matter support,20
+`
+
+	output, err := markdown.CSVTable(strings.NewReader(input), &markdown.CSVOptions{Align: "l-r"}, nil)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	os.Stdout.Write(output)
+
+	// Output:
+	// | Name        | Description                    | Stars |
+	// |:------------|--------------------------------|------:|
+	// | markdownfmt | Like gofmt, but for Markdown.  |   400 |
+	// | mdfmt       | Fork with front matter support |    20 |
+}
+
+func TestCSVTableTSV(t *testing.T) {
+	input := "Operator\tMeaning\n|\tbitwise or\n||\n"
+
+	got, err := markdown.CSVTable(strings.NewReader(input), &markdown.CSVOptions{Comma: '\t', Align: "c"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `| Operator | Meaning    |
+|:--------:|------------|
+|    \|    | bitwise or |
+|   \|\|   |            |
+`
+	if string(got) != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	// The table is already formatted.
+	again, err := markdown.Process("", got, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(again) != string(got) {
+		t.Errorf("formatting the table again changed it:\n%s", again)
+	}
+}
+
+func TestCSVTableInvalidAlignment(t *testing.T) {
+	_, err := markdown.CSVTable(strings.NewReader("a,b\n"), &markdown.CSVOptions{Align: "lx"}, nil)
+	if err == nil {
+		t.Error("got no error, want one for invalid alignment")
+	}
+}
+
+func TestCSVTableEscaping(t *testing.T) {
+	input := "Path,Note\n" +
+		`C:\dir\|x,*not emphasis*` + "\n" +
+		"snake_case_name,[not a link](url) <b> `code`\n"
+
+	got, err := markdown.CSVTable(strings.NewReader(input), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `| Path              | Note                               |
+|-------------------|------------------------------------|
+| C:\\dir\\\|x      | \*not emphasis\*                   |
+| snake\_case\_name | \[not a link\](url) \<b\> \` + "`code\\`" + ` |
+`
+	if string(got) != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	// The table is already formatted.
+	again, err := markdown.Process("", got, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(again) != string(got) {
+		t.Errorf("formatting the table again changed it:\n%s", again)
+	}
+}
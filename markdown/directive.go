@@ -0,0 +1,151 @@
+package markdown
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Diagnostic describes a problem found in a document
+// that doesn't prevent it from being formatted.
+type Diagnostic struct {
+	Line    int // Line number, starting at 1, or 0 if unknown.
+	Message string
+}
+
+func (d Diagnostic) String() string {
+	if d.Line == 0 {
+		return d.Message
+	}
+	return fmt.Sprintf("%d: %s", d.Line, d.Message)
+}
+
+// report reports d, if opt asks for diagnostics.
+func report(opt *Options, d Diagnostic) {
+	if opt != nil && opt.Report != nil {
+		opt.Report(d)
+	}
+}
+
+var optionsDirectiveRE = regexp.MustCompile(`^<!--\s*markdownfmt:\s*(.*?)\s*-->\s*$`)
+
+// documentOptions are the options that can be set by option directives,
+// keyed by the names used in directives.
+var documentOptions = map[string]func(opt *Options, value string) error{
+	"definition-lists":           boolOption(func(opt *Options, v bool) { opt.DefinitionLists = v }),
+	"header-ids":                 boolOption(func(opt *Options, v bool) { opt.HeaderIDs = v }),
+	"auto-header-ids":            boolOption(func(opt *Options, v bool) { opt.AutoHeaderIDs = v }),
+	"title-block":                boolOption(func(opt *Options, v bool) { opt.TitleBlock = v }),
+	"compact-tables":             boolOption(func(opt *Options, v bool) { opt.CompactTables = v }),
+	"max-table-column-width":     intOption(func(opt *Options, v int) { opt.MaxTableColumnWidth = v }),
+	"east-asian-ambiguous-width": intRangeOption(1, 2, func(opt *Options, v int) { opt.EastAsianAmbiguousWidth = v }),
+	"list-indent":                intOption(func(opt *Options, v int) { opt.ListIndent = v }),
+	"wrap":                       intOption(func(opt *Options, v int) { opt.WrapWidth = v }),
+	"pandoc":                     boolOption(func(opt *Options, v bool) { opt.Pandoc = v }),
+}
+
+// SetOption sets the option named key, as in option directives, to value.
+// It's an error if there is no such option, or if value is invalid for it.
+func SetOption(opt *Options, key, value string) error {
+	set, ok := documentOptions[key]
+	if !ok {
+		return fmt.Errorf("unknown option %q", key)
+	}
+	if err := set(opt, value); err != nil {
+		return fmt.Errorf("invalid value %q for option %q", value, key)
+	}
+	return nil
+}
+
+func boolOption(set func(opt *Options, v bool)) func(opt *Options, value string) error {
+	return func(opt *Options, value string) error {
+		v, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		set(opt, v)
+		return nil
+	}
+}
+
+func intOption(set func(opt *Options, v int)) func(opt *Options, value string) error {
+	return func(opt *Options, value string) error {
+		v, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		set(opt, v)
+		return nil
+	}
+}
+
+// intRangeOption is like intOption, but only accepts values from low to high.
+func intRangeOption(low, high int, set func(opt *Options, v int)) func(opt *Options, value string) error {
+	return func(opt *Options, value string) error {
+		v, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		if v < low || v > high {
+			return fmt.Errorf("%d is out of range", v)
+		}
+		set(opt, v)
+		return nil
+	}
+}
+
+// applyOptionsDirectives returns opt with the settings of option directives
+// at the top of the document merged over it, such as:
+//
+//	<!-- markdownfmt: pandoc definition-lists=false -->
+//
+// A key without a value sets the option to true.
+// Unknown keys and invalid values, and option directives further down
+// the document, are reported as diagnostics.
+func applyOptionsDirectives(lines [][]byte, opt *Options) *Options {
+	var merged *Options
+	for i, line := range lines {
+		if isBlank(line) {
+			continue
+		}
+		m := optionsDirectiveRE.FindSubmatch(line)
+		if m == nil || sortTableDirectiveRE.Match(line) {
+			checkLateOptionsDirectives(lines[i:], i, opt)
+			break
+		}
+		if merged == nil {
+			merged = new(Options)
+			if opt != nil {
+				*merged = *opt
+			}
+		}
+		for _, setting := range strings.Fields(string(m[1])) {
+			key, value := setting, "true"
+			if eq := strings.Index(setting, "="); eq != -1 {
+				key, value = setting[:eq], setting[eq+1:]
+			}
+			if err := SetOption(merged, key, value); err != nil {
+				report(opt, Diagnostic{Line: i + 1, Message: err.Error() + " in markdownfmt directive"})
+			}
+		}
+	}
+	if merged == nil {
+		return opt
+	}
+	return merged
+}
+
+// checkLateOptionsDirectives reports the option directives in lines, which
+// follow the top of the document, since they're ignored.
+func checkLateOptionsDirectives(lines [][]byte, first int, opt *Options) {
+	if opt == nil || opt.Report == nil {
+		return
+	}
+	inCodeBlock := codeBlockLines(lines)
+	for i, line := range lines {
+		if !inCodeBlock[i] && optionsDirectiveRE.Match(line) && !sortTableDirectiveRE.Match(line) {
+			report(opt, Diagnostic{Line: first + i + 1, Message: "markdownfmt directive isn't at the top of the document; it's ignored"})
+		}
+	}
+}
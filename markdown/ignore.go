@@ -0,0 +1,121 @@
+package markdown
+
+import (
+	"bytes"
+	"regexp"
+)
+
+// Directives for keeping parts of a document as they are.
+var (
+	ignoreStartRE = regexp.MustCompile(`^<!--\s*markdownfmt-ignore-start\s*-->\s*$`)
+	ignoreEndRE   = regexp.MustCompile(`^<!--\s*markdownfmt-ignore-end\s*-->\s*$`)
+	ignoreNextRE  = regexp.MustCompile(`^<!--\s*markdownfmt-ignore\s*-->\s*$`)
+)
+
+// segment is a part of a document.
+type segment struct {
+	lines [][]byte
+	// first is the index of the first line in the document. Functions that
+	// check lines take it as first, and report lines[i] as line first+i+1.
+	first    int
+	verbatim bool // Whether the segment is copied as is rather than formatted.
+}
+
+// splitIgnored splits lines into segments to be formatted and segments to be copied verbatim.
+// A verbatim segment spans from a markdownfmt-ignore-start directive to the matching
+// markdownfmt-ignore-end directive (or the end of the document), or from
+// a markdownfmt-ignore directive to the end of the block that follows it.
+func splitIgnored(lines [][]byte) []segment {
+	var segments []segment
+	add := func(start, end int, verbatim bool) {
+		if start < end {
+			segments = append(segments, segment{lines: lines[start:end], first: start, verbatim: verbatim})
+		}
+	}
+
+	inCodeBlock := codeBlockLines(lines)
+	start := 0 // Start of the current segment to be formatted.
+	for i := 0; i < len(lines); i++ {
+		if inCodeBlock[i] {
+			continue
+		}
+		var end int // End of the verbatim segment starting at i.
+		switch {
+		case ignoreStartRE.Match(lines[i]):
+			end = i + 1
+			for end < len(lines) && (inCodeBlock[end] || !ignoreEndRE.Match(lines[end])) {
+				end++
+			}
+			if end < len(lines) {
+				end++ // Include the end directive.
+			}
+		case ignoreNextRE.Match(lines[i]):
+			end = i + 1
+			for end < len(lines) && isBlank(lines[end]) {
+				end++
+			}
+			for end < len(lines) && (inCodeBlock[end] || !isBlank(lines[end])) {
+				end++
+			}
+		default:
+			continue
+		}
+		add(start, i, false)
+		add(i, end, true)
+		start, i = end, end-1
+	}
+	add(start, len(lines), false)
+	return segments
+}
+
+// checkLines reports the problems found in lines before they're formatted.
+func checkLines(lines [][]byte, first int, opt *Options) {
+	checkTableRows(lines, first, opt)
+	checkSortTableDirectives(lines, first, opt)
+	checkKeepSortedDirectives(lines, first, opt)
+	checkGoCode(lines, first, opt)
+}
+
+// process formats text, copying the parts marked with ignore directives verbatim.
+func process(text []byte, opt *Options) []byte {
+	var o Options
+	if opt != nil {
+		o = *opt
+	}
+	o.headerIDs = make(map[string]bool)
+	opt = &o
+
+	lines := splitLines(text)
+	segments := splitIgnored(lines)
+	pandoc := opt.Pandoc
+	if !pandoc && len(segments) <= 1 && (len(segments) == 0 || !segments[0].verbatim) {
+		checkLines(lines, 0, opt)
+		return render(text, opt)
+	}
+
+	references := referenceDefinitions(lines)
+	var out bytes.Buffer
+	for _, s := range segments {
+		switch {
+		case s.verbatim:
+			doubleSpace(&out)
+			out.Write(bytes.Join(s.lines, nil))
+		case pandoc:
+			checkLines(s.lines, s.first, opt)
+			writePandocBlocks(&out, s.lines, references, opt)
+		default:
+			checkLines(s.lines, s.first, opt)
+			text := bytes.Join(s.lines, nil)
+			if len(bytes.TrimSpace(text)) == 0 {
+				continue
+			}
+			doubleSpace(&out)
+			out.Write(render(append(text, references...), opt))
+		}
+	}
+	return out.Bytes()
+}
+
+func isBlank(line []byte) bool {
+	return len(bytes.TrimSpace(line)) == 0
+}
@@ -0,0 +1,178 @@
+package markdown
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/russross/blackfriday"
+)
+
+// keepSorted are the settings of a keep-sorted region, which spans from
+// a start directive to an end directive, such as:
+//
+//	<!-- keep-sorted start numeric=yes remove_duplicates=yes -->
+//	- Item 1
+//	- Item 10
+//	<!-- keep-sorted end -->
+//
+// Items of lists in the region are kept sorted case-insensitively,
+// each together with its nested items, as are lines of code blocks.
+type keepSorted struct {
+	numeric          bool // Whether runs of digits are compared by their numeric value.
+	removeDuplicates bool
+}
+
+var (
+	keepSortedStartRE = regexp.MustCompile(`^<!--\s*keep-sorted start(\s.*?)?\s*-->\s*$`)
+	keepSortedEndRE   = regexp.MustCompile(`^<!--\s*keep-sorted end\s*-->\s*$`)
+)
+
+// parseKeepSortedStart parses text as a keep-sorted start directive.
+// ok reports whether text is one, even if it has invalid settings.
+// Invalid settings are ignored, and returned as errs.
+func parseKeepSortedStart(text []byte) (ks keepSorted, ok bool, errs []error) {
+	m := keepSortedStartRE.FindSubmatch(text)
+	if m == nil {
+		return keepSorted{}, false, nil
+	}
+	for _, setting := range strings.Fields(string(m[1])) {
+		var key, value string
+		if eq := strings.Index(setting, "="); eq != -1 {
+			key, value = setting[:eq], setting[eq+1:]
+		}
+		var v bool
+		switch value {
+		case "yes", "true":
+			v = true
+		case "no", "false":
+			v = false
+		default:
+			errs = append(errs, fmt.Errorf("invalid setting %q in keep-sorted directive", setting))
+			continue
+		}
+		switch key {
+		case "numeric":
+			ks.numeric = v
+		case "remove_duplicates":
+			ks.removeDuplicates = v
+		default:
+			errs = append(errs, fmt.Errorf("unknown setting %q in keep-sorted directive", key))
+		}
+	}
+	return ks, true, errs
+}
+
+// checkKeepSortedDirectives reports the invalid settings of keep-sorted start directives in lines.
+func checkKeepSortedDirectives(lines [][]byte, first int, opt *Options) {
+	if opt == nil || opt.Report == nil {
+		return
+	}
+	inCodeBlock := codeBlockLines(lines)
+	for i, line := range lines {
+		if inCodeBlock[i] {
+			continue
+		}
+		_, _, errs := parseKeepSortedStart(line)
+		for _, err := range errs {
+			report(opt, Diagnostic{Line: first + i + 1, Message: err.Error()})
+		}
+	}
+}
+
+// order returns the indices of keys in sorted order, without duplicates
+// if they're to be removed. Equal keys keep their order.
+func (ks keepSorted) order(keys []string) []int {
+	var order []int
+	seen := make(map[string]bool)
+	for i, key := range keys {
+		if ks.removeDuplicates && seen[key] {
+			continue
+		}
+		seen[key] = true
+		order = append(order, i)
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := keys[order[i]], keys[order[j]]
+		if ks.numeric {
+			return naturalLess(a, b)
+		}
+		if la, lb := strings.ToLower(a), strings.ToLower(b); la != lb {
+			return la < lb
+		}
+		return a < b
+	})
+	return order
+}
+
+// keepSortedIn returns the settings of the keep-sorted region that out is in, if any.
+func (mr *markdownRenderer) keepSortedIn(out *bytes.Buffer) *keepSorted {
+	if mr.keepSortedOut != out {
+		return nil
+	}
+	return mr.keepSorted
+}
+
+// sortedListItem is an item of a list in a keep-sorted region.
+type sortedListItem struct {
+	text  []byte
+	flags int
+	loose bool // Whether the item uses a paragraph for large spacing.
+}
+
+// writeSortedListItems writes the collected items of a list in a keep-sorted region
+// in sorted order.
+func (mr *markdownRenderer) writeSortedListItems(out *bytes.Buffer, ks keepSorted, items []sortedListItem) {
+	keys := make([]string, len(items))
+	for i, item := range items {
+		keys[i] = string(bytes.TrimSpace(item.text))
+	}
+	order := ks.order(keys)
+	for i, index := range order {
+		item := items[index]
+		flags := item.flags &^ (blackfriday.LIST_ITEM_BEGINNING_OF_LIST | blackfriday.LIST_ITEM_END_OF_LIST)
+		if i == 0 {
+			flags |= blackfriday.LIST_ITEM_BEGINNING_OF_LIST
+		}
+		if i == len(order)-1 {
+			flags |= blackfriday.LIST_ITEM_END_OF_LIST
+		}
+		mr.paragraph[mr.listDepth] = item.loose
+		mr.ListItem(out, item.text, flags)
+	}
+}
+
+// sortLines sorts the lines of text, which ends with a newline.
+func (ks keepSorted) sortLines(text []byte) []byte {
+	lines := strings.SplitAfter(string(text), "\n")
+	lines = lines[:len(lines)-1]
+	var sorted bytes.Buffer
+	for _, i := range ks.order(lines) {
+		sorted.WriteString(lines[i])
+	}
+	return sorted.Bytes()
+}
+
+// separateKeepSortedDirectives returns text with blank lines around keep-sorted
+// directives, so that they aren't parsed as a part of an adjacent list.
+func separateKeepSortedDirectives(text []byte) []byte {
+	if !bytes.Contains(text, []byte("keep-sorted")) {
+		return text
+	}
+	lines := splitLines(text)
+	inCodeBlock := codeBlockLines(lines)
+	var out []byte
+	for i, line := range lines {
+		directive := !inCodeBlock[i] && (keepSortedStartRE.Match(line) || keepSortedEndRE.Match(line))
+		if directive && i > 0 && !isBlank(lines[i-1]) {
+			out = append(out, '\n')
+		}
+		out = append(out, line...)
+		if directive && i+1 < len(lines) && !isBlank(lines[i+1]) {
+			out = append(out, '\n')
+		}
+	}
+	return out
+}
@@ -0,0 +1,30 @@
+package markdown
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestKeepSortedDirectiveDiagnostics(t *testing.T) {
+	input := []byte("Text.\n\n" + `<!-- keep-sorted start numeric=maybe sticky=yes -->
+- b
+- a
+<!-- keep-sorted end -->
+
+` + "```" + `
+<!-- keep-sorted start case=no -->
+` + "```" + `
+`)
+	var got []string
+	_, err := Process("", input, &Options{Report: func(d Diagnostic) { got = append(got, d.String()) }})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		`3: invalid setting "numeric=maybe" in keep-sorted directive`,
+		`3: unknown setting "sticky" in keep-sorted directive`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,67 @@
+package markdown
+
+import (
+	"bytes"
+	"regexp"
+)
+
+// The helpers in this file are used by passes over source lines that happen
+// before parsing, for constructs that blackfriday doesn't handle.
+
+var (
+	codeFenceRE     = regexp.MustCompile("^ {0,3}(`{3,}|~{3,})")
+	referenceLineRE = regexp.MustCompile(`^ {0,3}\[[^\]]+\]:[ \t]`)
+)
+
+// splitLines splits text into lines, each including its terminating newline.
+// A missing newline at the end of text is added.
+func splitLines(text []byte) [][]byte {
+	if len(text) == 0 {
+		return nil
+	}
+	if text[len(text)-1] != '\n' {
+		text = append(text[:len(text):len(text)], '\n')
+	}
+	lines := bytes.SplitAfter(text, []byte("\n"))
+	return lines[:len(lines)-1]
+}
+
+// codeBlockLines reports for each line whether it's a part of a fenced code block,
+// including the fences.
+func codeBlockLines(lines [][]byte) []bool {
+	inCodeBlock := make([]bool, len(lines))
+	var fence string // Opening fence of the current code block, if any.
+	for i, line := range lines {
+		switch {
+		case fence != "":
+			inCodeBlock[i] = true
+			if isClosingCodeFence(line, fence) {
+				fence = ""
+			}
+		case codeFenceRE.Match(line):
+			inCodeBlock[i] = true
+			fence = string(codeFenceRE.FindSubmatch(line)[1])
+		}
+	}
+	return inCodeBlock
+}
+
+// isClosingCodeFence reports whether line closes a code block opened with fence.
+func isClosingCodeFence(line []byte, fence string) bool {
+	trimmed := bytes.TrimSpace(line)
+	return len(trimmed) >= len(fence) && len(bytes.Trim(trimmed, fence[:1])) == 0 && len(line)-len(bytes.TrimLeft(line, " ")) <= 3
+}
+
+// referenceDefinitions returns the reference definition lines in lines.
+// When a document is formatted in parts, they're made available to every part,
+// since links may refer to a definition in another part.
+func referenceDefinitions(lines [][]byte) []byte {
+	var references []byte
+	inCodeBlock := codeBlockLines(lines)
+	for i, line := range lines {
+		if !inCodeBlock[i] && referenceLineRE.Match(line) {
+			references = append(references, line...)
+		}
+	}
+	return references
+}
@@ -5,18 +5,23 @@ import (
 	"bytes"
 	"fmt"
 	"go/format"
+	"go/scanner"
 	"io/ioutil"
+	"regexp"
 	"strings"
 
-	"github.com/mattn/go-runewidth"
 	"github.com/russross/blackfriday"
 	"github.com/shurcooL/go/indentwriter"
 )
 
 type markdownRenderer struct {
 	normalTextMarker   map[*bytes.Buffer]int
+	attributesMarker   map[*bytes.Buffer]int // Used to keep track of where Pandoc attributes of a span may follow.
 	orderedListCounter map[int]int
 	paragraph          map[int]bool // Used to keep track of whether a given list item uses a paragraph for large spacing.
+	paragraphOut       *bytes.Buffer
+	breakableSpaces    []int                   // Positions in paragraphOut of spaces in normal text, where lines may be wrapped.
+	listItemSpaces     map[*bytes.Buffer][]int // Positions of spaces in normal text written outside paragraphs in lists, by buffer.
 	listDepth          int
 	lastNormalText     string
 
@@ -24,7 +29,24 @@ type markdownRenderer struct {
 	headers      []string
 	columnAligns []int
 	columnWidths []int
-	cells        []string
+	rows         [][]string // Body rows, each with as many cells as there are headers.
+	row          []string   // Cells of the body row being rendered.
+
+	// sortTable is the sort-table directive that applies to the table
+	// rendered next to sortTableOut at sortTableMarker, if any.
+	sortTable       *tableSort
+	sortTableOut    *bytes.Buffer
+	sortTableMarker int
+
+	// keepSorted are the settings of the keep-sorted region being rendered
+	// to keepSortedOut, if any.
+	keepSorted    *keepSorted
+	keepSortedOut *bytes.Buffer
+
+	// sortedListDepth is the depth of the list in a keep-sorted region
+	// whose items are being collected into sortedListItems, or 0 if none.
+	sortedListDepth int
+	sortedListItems []sortedListItem
 
 	opt Options
 
@@ -33,22 +55,83 @@ type markdownRenderer struct {
 }
 
 func formatCode(lang string, text []byte) (formattedCode []byte, ok bool) {
-	switch lang {
-	case "Go", "go":
-		gofmt, err := format.Source(text)
-		if err != nil {
-			return nil, false
-		}
-		return gofmt, true
-	default:
+	if !isGoCode(lang) {
 		return nil, false
 	}
+	gofmt, err := format.Source(text)
+	if err != nil {
+		return nil, false
+	}
+	return gofmt, true
+}
+
+// isGoCode reports whether code in a block of language lang is formatted as Go.
+func isGoCode(lang string) bool {
+	return lang == "Go" || lang == "go"
+}
+
+// codeLanguage returns the language that the code of a block with the info
+// string info, as given by blackfriday, is formatted as.
+func codeLanguage(info string, pandoc bool) string {
+	if attrs, ok := parseAttributes(info); pandoc && ok && strings.ContainsAny(info, "#.=") {
+		if class, ok := attrs.singleClass(); ok {
+			return class
+		}
+		if len(attrs.classes) > 0 {
+			return attrs.classes[0]
+		}
+	}
+	return info
+}
+
+// checkGoCode reports fenced Go code blocks in lines that can't be formatted,
+// which are left as they are.
+func checkGoCode(lines [][]byte, first int, opt *Options) {
+	if opt == nil || opt.Report == nil {
+		return
+	}
+	for i := 0; i < len(lines); i++ {
+		m := codeFenceRE.FindSubmatch(lines[i])
+		if m == nil {
+			continue
+		}
+		fence, info := string(m[1]), strings.TrimSpace(string(lines[i][len(m[0]):]))
+		if strings.HasPrefix(info, "{") && strings.HasSuffix(info, "}") {
+			info = strings.TrimSpace(info[1 : len(info)-1])
+		}
+		start := i
+		for i++; i < len(lines) && !isClosingCodeFence(lines[i], fence); i++ {
+		}
+		if !isGoCode(codeLanguage(info, opt.Pandoc)) {
+			continue
+		}
+		_, err := format.Source(bytes.Join(lines[start+1:i], nil))
+		if err == nil {
+			continue
+		}
+		d := Diagnostic{Line: first + start + 1, Message: "Go code block isn't formatted: " + err.Error()}
+		if errs, ok := err.(scanner.ErrorList); ok && len(errs) != 0 {
+			d = Diagnostic{Line: first + start + 1 + errs[0].Pos.Line, Message: "Go code block isn't formatted: " + errs[0].Msg}
+		}
+		report(opt, d)
+	}
 }
 
 // Block-level callbacks.
-func (*markdownRenderer) BlockCode(out *bytes.Buffer, text []byte, lang string) {
+func (mr *markdownRenderer) BlockCode(out *bytes.Buffer, text []byte, lang string) {
 	doubleSpace(out)
 
+	if attrs, ok := parseAttributes(lang); mr.opt.Pandoc && ok && strings.ContainsAny(lang, "#.=") {
+		if _, ok := attrs.singleClass(); !ok {
+			out.WriteString("```")
+			out.WriteString(attrs.String())
+			out.WriteString("\n")
+			mr.writeCode(out, text, codeLanguage(lang, true))
+			return
+		}
+		lang = codeLanguage(lang, true)
+	}
+
 	// Parse out the language name.
 	count := 0
 	for _, elt := range strings.Fields(lang) {
@@ -69,6 +152,14 @@ func (*markdownRenderer) BlockCode(out *bytes.Buffer, text []byte, lang string)
 	}
 	out.WriteString("\n")
 
+	mr.writeCode(out, text, lang)
+}
+
+// writeCode writes the contents and closing fence of a code block.
+func (mr *markdownRenderer) writeCode(out *bytes.Buffer, text []byte, lang string) {
+	if ks := mr.keepSortedIn(out); ks != nil {
+		text = ks.sortLines(text)
+	}
 	if formattedCode, ok := formatCode(lang, text); ok {
 		out.Write(formattedCode)
 	} else {
@@ -92,18 +183,46 @@ func (*markdownRenderer) BlockQuote(out *bytes.Buffer, text []byte) {
 		out.WriteString("\n")
 	}
 }
-func (*markdownRenderer) BlockHtml(out *bytes.Buffer, text []byte) {
+func (mr *markdownRenderer) BlockHtml(out *bytes.Buffer, text []byte) {
 	doubleSpace(out)
 	out.Write(text)
 	out.WriteByte('\n')
+
+	if ks, ok, _ := parseKeepSortedStart(text); ok {
+		mr.keepSorted, mr.keepSortedOut = &ks, out
+		return
+	}
+	if keepSortedEndRE.Match(text) {
+		mr.keepSorted, mr.keepSortedOut = nil, nil
+		return
+	}
+	if sort, ok, err := parseSortTableDirective(text); ok {
+		if err != nil {
+			return // Reported by checkSortTableDirectives.
+		}
+		mr.sortTable, mr.sortTableOut, mr.sortTableMarker = &sort, out, out.Len()
+	}
 }
 func (*markdownRenderer) TitleBlock(out *bytes.Buffer, text []byte) {
+	doubleSpace(out)
+	for _, line := range bytes.Split(text, []byte("\n")) {
+		line = bytes.Join(bytes.Fields(bytes.TrimPrefix(line, []byte("%"))), []byte(" "))
+		out.WriteString("%")
+		if len(line) != 0 {
+			out.WriteString(" ")
+			out.Write(line)
+		}
+		out.WriteString("\n")
+	}
 }
 func (mr *markdownRenderer) Header(out *bytes.Buffer, text func() bool, level int, id string) {
 	marker := out.Len()
 	doubleSpace(out)
 
-	if level >= 3 {
+	// Headers with an ID are always written in ATX style,
+	// since IDs are only parsed for those.
+	atx := level >= 3 || id != ""
+	if atx {
 		fmt.Fprint(out, strings.Repeat("#", level), " ")
 	}
 
@@ -112,17 +231,56 @@ func (mr *markdownRenderer) Header(out *bytes.Buffer, text func() bool, level in
 		out.Truncate(marker)
 		return
 	}
+	if id != "" && mr.opt.AutoHeaderIDs {
+		id = mr.uniqueHeaderID(id, out.String()[textMarker:])
+	}
+
+	if mr.opt.Pandoc {
+		if rest, attrs, ok := trailingAttributes(out.String()[textMarker:]); ok {
+			if id != "" {
+				attrs.id = id
+			}
+			out.Truncate(textMarker)
+			out.WriteString(rest)
+			out.WriteString(" ")
+			out.WriteString(attrs.String())
+			id = ""
+		}
+	}
 
-	switch level {
-	case 1:
+	switch {
+	case atx:
+		if id != "" {
+			fmt.Fprintf(out, " {#%s}", id)
+		}
+	case level == 1:
 		len := mr.stringWidth(out.String()[textMarker:])
 		fmt.Fprint(out, "\n", strings.Repeat("=", len))
-	case 2:
+	case level == 2:
 		len := mr.stringWidth(out.String()[textMarker:])
 		fmt.Fprint(out, "\n", strings.Repeat("-", len))
 	}
 	out.WriteString("\n")
 }
+
+// uniqueHeaderID records id as used by a header of the document with text.
+// If id was generated from text and another header already uses it, it returns
+// id with the first free "-1", "-2", … suffix instead, as GitHub does.
+func (mr *markdownRenderer) uniqueHeaderID(id, text string) string {
+	if mr.opt.headerIDs == nil {
+		mr.opt.headerIDs = make(map[string]bool)
+	}
+	if mr.opt.headerIDs[id] && id == blackfriday.SanitizedAnchorName(text) {
+		for n := 1; ; n++ {
+			if unique := fmt.Sprintf("%s-%d", id, n); !mr.opt.headerIDs[unique] {
+				id = unique
+				break
+			}
+		}
+	}
+	mr.opt.headerIDs[id] = true
+	return id
+}
 func (*markdownRenderer) HRule(out *bytes.Buffer) {
 	doubleSpace(out)
 	out.WriteString("---\n")
@@ -133,23 +291,92 @@ func (mr *markdownRenderer) List(out *bytes.Buffer, text func() bool, flags int)
 
 	mr.listDepth++
 	defer func() { mr.listDepth-- }()
+	if mr.listDepth == 1 {
+		defer func() { mr.listItemSpaces = nil }()
+	}
 	if flags&blackfriday.LIST_TYPE_ORDERED != 0 {
 		mr.orderedListCounter[mr.listDepth] = 1
 	}
+
+	ks := mr.keepSortedIn(out)
+	if ks != nil && flags&blackfriday.LIST_TYPE_DEFINITION == 0 {
+		// Collect the items, and write them once they're all known.
+		outerDepth, outerItems := mr.sortedListDepth, mr.sortedListItems
+		defer func() { mr.sortedListDepth, mr.sortedListItems = outerDepth, outerItems }()
+		mr.sortedListDepth, mr.sortedListItems = mr.listDepth, nil
+	}
+	itemsMarker := out.Len()
 	if !text() {
 		out.Truncate(marker)
 		return
 	}
+	if ks != nil && mr.sortedListDepth == mr.listDepth {
+		items := mr.sortedListItems
+		mr.sortedListDepth = 0
+		out.Truncate(itemsMarker)
+		mr.orderedListCounter[mr.listDepth] = 1
+		mr.writeSortedListItems(out, *ks, items)
+	}
 }
 func (mr *markdownRenderer) ListItem(out *bytes.Buffer, text []byte, flags int) {
+	if mr.opt.WrapWidth > 0 && flags&(blackfriday.LIST_ITEM_CONTAINS_BLOCK|blackfriday.LIST_TYPE_TERM) == 0 {
+		mr.markListItemBreaks(text)
+	}
+	if mr.sortedListDepth == mr.listDepth {
+		mr.sortedListItems = append(mr.sortedListItems, sortedListItem{
+			text:  append([]byte(nil), text...),
+			flags: flags,
+			loose: mr.paragraph[mr.listDepth],
+		})
+	}
+	if flags&blackfriday.LIST_TYPE_DEFINITION != 0 {
+		mr.definitionListItem(out, text, flags)
+		return
+	}
 	if flags&blackfriday.LIST_TYPE_ORDERED != 0 {
-		fmt.Fprintf(out, "%d.", mr.orderedListCounter[mr.listDepth])
-		indentwriter.New(out, 1).Write(text)
+		mr.writeListItem(out, fmt.Sprintf("%d.", mr.orderedListCounter[mr.listDepth]), text)
 		mr.orderedListCounter[mr.listDepth]++
 	} else {
-		out.WriteString("-")
-		indentwriter.New(out, 1).Write(text)
+		mr.writeListItem(out, "-", text)
+	}
+	out.WriteString("\n")
+	if mr.paragraph[mr.listDepth] {
+		if flags&blackfriday.LIST_ITEM_END_OF_LIST == 0 {
+			out.WriteString("\n")
+		}
+		mr.paragraph[mr.listDepth] = false
+	}
+}
+
+// markListItemBreaks marks the spaces that the text of a tight list item
+// can be wrapped at. Blackfriday renders the text to a buffer of its own,
+// which text is the start of.
+func (mr *markdownRenderer) markListItemBreaks(text []byte) {
+	if len(text) == 0 {
+		return
+	}
+	for buf, spaces := range mr.listItemSpaces {
+		if b := buf.Bytes(); len(b) != 0 && &b[0] == &text[0] {
+			markBreaks(text, spaces)
+			delete(mr.listItemSpaces, buf)
+			return
+		}
 	}
+}
+
+// definitionListItem renders a term or a definition of a definition list.
+// Each term other than the first is preceded by a blank line, since
+// a term directly following a definition would be parsed as part of it.
+func (mr *markdownRenderer) definitionListItem(out *bytes.Buffer, text []byte, flags int) {
+	if flags&blackfriday.LIST_TYPE_TERM != 0 {
+		if flags&blackfriday.LIST_ITEM_BEGINNING_OF_LIST == 0 && !bytes.HasSuffix(out.Bytes(), []byte("\n\n")) {
+			out.WriteString("\n")
+		}
+		out.Write(text)
+		out.WriteString("\n")
+		return
+	}
+	mr.writeListItem(out, ":", text)
 	out.WriteString("\n")
 	if mr.paragraph[mr.listDepth] {
 		if flags&blackfriday.LIST_ITEM_END_OF_LIST == 0 {
@@ -158,20 +385,81 @@ func (mr *markdownRenderer) ListItem(out *bytes.Buffer, text []byte, flags int)
 		mr.paragraph[mr.listDepth] = false
 	}
 }
+
+var listItemLineRE = regexp.MustCompile(`^ *([-+*]|[0-9]+[.)])[ \t]`)
+
+// writeListItem writes the marker of a list item followed by its indented text.
+func (mr *markdownRenderer) writeListItem(out *bytes.Buffer, marker string, text []byte) {
+	out.WriteString(marker)
+	if mr.opt.ListIndent <= 0 {
+		indentwriter.New(out, 1).Write(text)
+		return
+	}
+	width := mr.listIndentWidth(marker)
+	if width < 4 && hasBlockAfterBlankLine(text) {
+		// Blocks other than lists after a blank line are only parsed as
+		// a part of the item if they're indented by at least 4 columns.
+		width = 4
+	}
+	indent := strings.Repeat(" ", width)
+	out.WriteString(indent[len(marker):])
+	for i, line := range bytes.SplitAfter(text, []byte("\n")) {
+		if i > 0 && len(bytes.TrimSpace(line)) != 0 {
+			out.WriteString(indent)
+		}
+		out.Write(line)
+	}
+}
+
+// hasBlockAfterBlankLine reports whether text has a block other than a list after a blank line.
+func hasBlockAfterBlankLine(text []byte) bool {
+	lines := bytes.Split(text, []byte("\n"))
+	for i := 1; i < len(lines); i++ {
+		if isBlank(lines[i-1]) && !isBlank(lines[i]) && !listItemLineRE.Match(lines[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// listIndentWidth returns the width of the indentation of list items with marker.
+// A tab is counted as 4 columns.
+func (mr *markdownRenderer) listIndentWidth(marker string) int {
+	if mr.opt.ListIndent <= 0 {
+		return 4
+	}
+	if mr.opt.ListIndent <= len(marker) {
+		return len(marker) + 1
+	}
+	return mr.opt.ListIndent
+}
+
 func (mr *markdownRenderer) Paragraph(out *bytes.Buffer, text func() bool) {
 	marker := out.Len()
 	doubleSpace(out)
 
 	mr.paragraph[mr.listDepth] = true
 
-	if !text() {
+	mr.paragraphOut, mr.breakableSpaces = out, nil
+	ok := text()
+	mr.paragraphOut = nil
+	if !ok {
 		out.Truncate(marker)
 		return
 	}
+	if mr.opt.WrapWidth > 0 {
+		markBreaks(out.Bytes(), mr.breakableSpaces)
+	}
 	out.WriteString("\n")
 }
 
 func (mr *markdownRenderer) Table(out *bytes.Buffer, header, body []byte, columnData []int) {
+	mr.normalizeTableColumns()
+	if mr.sortTable != nil && mr.sortTableOut == out && mr.sortTableMarker == out.Len() {
+		mr.sortTableRows(*mr.sortTable)
+	}
+	mr.sortTable, mr.sortTableOut = nil, nil
+
 	doubleSpace(out)
 	for column, cell := range mr.headers {
 		out.WriteByte('|')
@@ -190,6 +478,9 @@ func (mr *markdownRenderer) Table(out *bytes.Buffer, header, body []byte, column
 		} else {
 			out.WriteByte('-')
 		}
+		if width < 1 {
+			width = 1
+		}
 		for ; width > 0; width-- {
 			out.WriteByte('-')
 		}
@@ -200,34 +491,32 @@ func (mr *markdownRenderer) Table(out *bytes.Buffer, header, body []byte, column
 		}
 	}
 	out.WriteString("|\n")
-	for i := 0; i < len(mr.cells); {
-		for column := range mr.headers {
-			cell := []byte(mr.cells[i])
-			i++
+	for _, row := range mr.rows {
+		for column, cell := range row {
 			out.WriteByte('|')
 			out.WriteByte(' ')
 			switch mr.columnAligns[column] {
 			default:
 				fallthrough
 			case blackfriday.TABLE_ALIGNMENT_LEFT:
-				out.Write(cell)
-				for i := mr.stringWidth(string(cell)); i < mr.columnWidths[column]; i++ {
+				out.WriteString(cell)
+				for i := mr.stringWidth(cell); i < mr.columnWidths[column]; i++ {
 					out.WriteByte(' ')
 				}
 			case blackfriday.TABLE_ALIGNMENT_CENTER:
-				spaces := mr.columnWidths[column] - mr.stringWidth(string(cell))
+				spaces := mr.columnWidths[column] - mr.stringWidth(cell)
 				for i := 0; i < spaces/2; i++ {
 					out.WriteByte(' ')
 				}
-				out.Write(cell)
+				out.WriteString(cell)
 				for i := 0; i < spaces-(spaces/2); i++ {
 					out.WriteByte(' ')
 				}
 			case blackfriday.TABLE_ALIGNMENT_RIGHT:
-				for i := mr.stringWidth(string(cell)); i < mr.columnWidths[column]; i++ {
+				for i := mr.stringWidth(cell); i < mr.columnWidths[column]; i++ {
 					out.WriteByte(' ')
 				}
-				out.Write(cell)
+				out.WriteString(cell)
 			}
 			out.WriteByte(' ')
 		}
@@ -237,23 +526,72 @@ func (mr *markdownRenderer) Table(out *bytes.Buffer, header, body []byte, column
 	mr.headers = nil
 	mr.columnAligns = nil
 	mr.columnWidths = nil
-	mr.cells = nil
+	mr.rows = nil
+	mr.row = nil
+}
+
+// normalizeTableColumns makes sure every row of the table being rendered has
+// as many cells as there are headers, and computes the column widths.
+// A table without headers gets empty ones, as many as there are cells in its widest row.
+func (mr *markdownRenderer) normalizeTableColumns() {
+	if len(mr.row) != 0 {
+		// The last row wasn't followed by a TableRow call.
+		mr.TableRow(nil, nil)
+	}
+	if len(mr.headers) == 0 {
+		for _, row := range mr.rows {
+			for len(mr.headers) < len(row) {
+				mr.headers = append(mr.headers, "")
+			}
+		}
+	}
+	for len(mr.columnAligns) < len(mr.headers) {
+		mr.columnAligns = append(mr.columnAligns, 0)
+	}
+	mr.columnWidths = make([]int, len(mr.headers))
+	for column, cell := range mr.headers {
+		mr.columnWidths[column] = mr.paddedWidth(cell)
+	}
+	for i, row := range mr.rows {
+		if len(row) != len(mr.headers) {
+			report(&mr.opt, Diagnostic{Message: raggedRowMessage(len(row), len(mr.headers))})
+		}
+		for len(row) < len(mr.headers) {
+			row = append(row, "")
+		}
+		row = row[:len(mr.headers)]
+		mr.rows[i] = row
+		for column, cell := range row {
+			if width := mr.paddedWidth(cell); width > mr.columnWidths[column] {
+				mr.columnWidths[column] = width
+			}
+		}
+	}
 }
-func (*markdownRenderer) TableRow(out *bytes.Buffer, text []byte) {
+func (mr *markdownRenderer) TableRow(out *bytes.Buffer, text []byte) {
+	if mr.row == nil {
+		// A header row.
+		return
+	}
+	mr.rows = append(mr.rows, mr.row)
+	mr.row = nil
 }
 func (mr *markdownRenderer) TableHeaderCell(out *bytes.Buffer, text []byte, align int) {
 	mr.columnAligns = append(mr.columnAligns, align)
-	columnWidth := mr.stringWidth(string(text))
-	mr.columnWidths = append(mr.columnWidths, columnWidth)
 	mr.headers = append(mr.headers, string(text))
 }
 func (mr *markdownRenderer) TableCell(out *bytes.Buffer, text []byte, align int) {
-	columnWidth := mr.stringWidth(string(text))
-	column := len(mr.cells) % len(mr.headers)
-	if columnWidth > mr.columnWidths[column] {
-		mr.columnWidths[column] = columnWidth
+	mr.row = append(mr.row, string(text))
+}
+
+// paddedWidth returns the width that other cells in the column of cell
+// are padded to on its account.
+func (mr *markdownRenderer) paddedWidth(cell string) int {
+	width := mr.stringWidth(cell)
+	if mr.opt.CompactTables || (mr.opt.MaxTableColumnWidth > 0 && width > mr.opt.MaxTableColumnWidth) {
+		return 0
 	}
-	mr.cells = append(mr.cells, string(text))
+	return width
 }
 
 func (*markdownRenderer) Footnotes(out *bytes.Buffer, text func() bool) {
@@ -267,10 +605,11 @@ func (*markdownRenderer) FootnoteItem(out *bytes.Buffer, name, text []byte, flag
 func (*markdownRenderer) AutoLink(out *bytes.Buffer, link []byte, kind int) {
 	out.Write(escape(link))
 }
-func (*markdownRenderer) CodeSpan(out *bytes.Buffer, text []byte) {
+func (mr *markdownRenderer) CodeSpan(out *bytes.Buffer, text []byte) {
 	out.WriteByte('`')
 	out.Write(text)
 	out.WriteByte('`')
+	mr.attributesMarker[out] = out.Len()
 }
 func (mr *markdownRenderer) DoubleEmphasis(out *bytes.Buffer, text []byte) {
 	if mr.opt.Terminal {
@@ -291,7 +630,7 @@ func (*markdownRenderer) Emphasis(out *bytes.Buffer, text []byte) {
 	out.Write(text)
 	out.WriteByte('*')
 }
-func (*markdownRenderer) Image(out *bytes.Buffer, link, title, alt []byte) {
+func (mr *markdownRenderer) Image(out *bytes.Buffer, link, title, alt []byte) {
 	out.WriteString("![")
 	out.Write(alt)
 	out.WriteString("](")
@@ -302,11 +641,12 @@ func (*markdownRenderer) Image(out *bytes.Buffer, link, title, alt []byte) {
 		out.WriteString(`"`)
 	}
 	out.WriteString(")")
+	mr.attributesMarker[out] = out.Len()
 }
 func (*markdownRenderer) LineBreak(out *bytes.Buffer) {
 	out.WriteString("  \n")
 }
-func (*markdownRenderer) Link(out *bytes.Buffer, link, title, content []byte) {
+func (mr *markdownRenderer) Link(out *bytes.Buffer, link, title, content []byte) {
 	out.WriteString("[")
 	out.Write(content)
 	out.WriteString("](")
@@ -317,6 +657,7 @@ func (*markdownRenderer) Link(out *bytes.Buffer, link, title, content []byte) {
 		out.WriteString(`"`)
 	}
 	out.WriteString(")")
+	mr.attributesMarker[out] = out.Len()
 }
 func (*markdownRenderer) RawHtmlTag(out *bytes.Buffer, tag []byte) {
 	out.Write(tag)
@@ -360,7 +701,8 @@ func needsEscaping(text []byte, lastNormalText string) bool {
 		"(", ")",
 		"#",
 		"+",
-		"-":
+		"-",
+		"|":
 		return true
 	case "!":
 		return false
@@ -379,6 +721,9 @@ func (*markdownRenderer) Entity(out *bytes.Buffer, entity []byte) {
 	out.Write(entity)
 }
 func (mr *markdownRenderer) NormalText(out *bytes.Buffer, text []byte) {
+	if mr.opt.Pandoc {
+		defer mr.normalizeAttributes(out)
+	}
 	normalText := string(text)
 	if needsEscaping(text, mr.lastNormalText) {
 		text = append([]byte("\\"), text...)
@@ -394,15 +739,67 @@ func (mr *markdownRenderer) NormalText(out *bytes.Buffer, text []byte) {
 	if mr.skipSpaceIfNeededNormalText(out, cleanString) { // Skip first space if last character is already a space (i.e., no need for a 2nd space in a row).
 		cleanString = cleanString[1:]
 	}
+	if out == mr.paragraphOut {
+		for i := 0; i < len(cleanString); i++ {
+			if cleanString[i] == ' ' {
+				mr.breakableSpaces = append(mr.breakableSpaces, out.Len()+i)
+			}
+		}
+	} else if mr.opt.WrapWidth > 0 && mr.listDepth > 0 {
+		if mr.listItemSpaces == nil {
+			mr.listItemSpaces = make(map[*bytes.Buffer][]int)
+		}
+		for i := 0; i < len(cleanString); i++ {
+			if cleanString[i] == ' ' {
+				mr.listItemSpaces[out] = append(mr.listItemSpaces[out], out.Len()+i)
+			}
+		}
+	}
 	out.WriteString(cleanString)
 	if len(cleanString) >= 1 && cleanString[len(cleanString)-1] == ' ' { // If it ends with a space, make note of that.
 		mr.normalTextMarker[out] = out.Len()
 	}
 }
 
+// normalizeAttributes normalizes the Pandoc attribute block of the link, image or
+// code span last written to out, once all of its text has been written.
+// The text of an attribute block may come in several pieces, for example
+// when it contains underscores.
+func (mr *markdownRenderer) normalizeAttributes(out *bytes.Buffer) {
+	start, ok := mr.attributesMarker[out]
+	if !ok || start == out.Len() {
+		return
+	}
+	text := out.String()[start:]
+	if text[0] != '{' {
+		delete(mr.attributesMarker, out)
+		return
+	}
+	if !strings.Contains(text, "}") {
+		// Wait for more text.
+		return
+	}
+	delete(mr.attributesMarker, out)
+	if attrs, rest, ok := leadingAttributes(text); ok {
+		endsWithSpace := mr.normalTextMarker[out] == out.Len()
+		out.Truncate(start)
+		out.WriteString(attrs.String())
+		out.WriteString(rest)
+		if endsWithSpace {
+			mr.normalTextMarker[out] = out.Len()
+		}
+	}
+}
+
 // Header and footer.
 func (*markdownRenderer) DocumentHeader(out *bytes.Buffer) {}
-func (*markdownRenderer) DocumentFooter(out *bytes.Buffer) {}
+func (mr *markdownRenderer) DocumentFooter(out *bytes.Buffer) {
+	if mr.opt.WrapWidth > 0 {
+		b := mr.wrapLines(out.Bytes())
+		out.Reset()
+		out.Write(b)
+	}
+}
 
 func (*markdownRenderer) GetFlags() int { return 0 }
 
@@ -439,30 +836,21 @@ func doubleSpace(out *bytes.Buffer) {
 	}
 }
 
-// terminalStringWidth returns width of s, taking into account possible ANSI escape codes
-// (which don't count towards string width).
-func terminalStringWidth(s string) (width int) {
-	width = runewidth.StringWidth(s)
-	width -= strings.Count(s, "\x1b[1m") * len("[1m") // HACK, TODO: Find a better way of doing this.
-	width -= strings.Count(s, "\x1b[0m") * len("[0m") // HACK, TODO: Find a better way of doing this.
-	return width
-}
-
 // NewRenderer returns a Markdown renderer.
 // If opt is nil the defaults are used.
 func NewRenderer(opt *Options) blackfriday.Renderer {
 	mr := &markdownRenderer{
 		normalTextMarker:   make(map[*bytes.Buffer]int),
+		attributesMarker:   make(map[*bytes.Buffer]int),
 		orderedListCounter: make(map[int]int),
 		paragraph:          make(map[int]bool),
-
-		stringWidth: runewidth.StringWidth,
 	}
 	if opt != nil {
 		mr.opt = *opt
 	}
+	mr.stringWidth = newStringWidth(mr.opt.EastAsianAmbiguousWidth == 2)
 	if mr.opt.Terminal {
-		mr.stringWidth = terminalStringWidth
+		mr.stringWidth = terminalStringWidth(mr.stringWidth)
 	}
 	return mr
 }
@@ -471,10 +859,63 @@ func NewRenderer(opt *Options) blackfriday.Renderer {
 type Options struct {
 	// Terminal specifies if ANSI escape codes are emitted for styling.
 	Terminal bool
+
+	// DefinitionLists specifies if definition lists
+	// ("Term" followed by ": Definition" lines) are recognized.
+	DefinitionLists bool
+
+	// HeaderIDs specifies if custom header IDs ("# Header {#id}") are recognized
+	// and preserved. Headers with an ID are always written in ATX style.
+	HeaderIDs bool
+
+	// AutoHeaderIDs specifies if headers without a custom ID are given one
+	// generated from their text, so that anchors survive later edits of
+	// the header text. It implies HeaderIDs.
+	AutoHeaderIDs bool
+
+	// TitleBlock specifies if a Pandoc title block ("% Title", "% Author", "% Date"
+	// lines at the top of the document) is recognized and preserved.
+	TitleBlock bool
+
+	// CompactTables specifies if table cells are separated by single spaces
+	// rather than padded to align the columns.
+	CompactTables bool
+
+	// MaxTableColumnWidth, if positive, is the width of table cells beyond which
+	// they're not padded, and don't cause other cells in their column to be padded.
+	MaxTableColumnWidth int
+
+	// EastAsianAmbiguousWidth is the width of East Asian ambiguous characters
+	// when aligning tables and header underlines, either 1 or 2.
+	// Zero means 1.
+	EastAsianAmbiguousWidth int
+
+	// ListIndent, if positive, is the number of spaces that the content of list
+	// items is indented by, rather than a tab. It's at least one more than the
+	// width of the list marker.
+	ListIndent int
+
+	// WrapWidth, if positive, is the width that lines of paragraphs are wrapped at.
+	// Words wider than it, links and other spans aren't broken.
+	WrapWidth int
+
+	// Pandoc specifies if Pandoc fenced divs ("::: warning") and attributes
+	// ("{#id .class key=val}") on headers, links, images, code spans and
+	// code blocks are recognized. Attributes are written in normalized order.
+	Pandoc bool
+
+	// Report, if not nil, is called for each problem found in the document
+	// that doesn't prevent it from being formatted.
+	Report func(Diagnostic)
+
+	// headerIDs are the IDs of the headers of the document, shared by the
+	// renderers of its parts.
+	headerIDs map[string]bool
 }
 
 // Process formats Markdown.
 // If opt is nil the defaults are used.
+// Option directives at the top of the document are merged over opt.
 // Error can only occur when reading input from filename rather than src.
 func Process(filename string, src []byte, opt *Options) ([]byte, error) {
 	// Get source.
@@ -483,17 +924,34 @@ func Process(filename string, src []byte, opt *Options) ([]byte, error) {
 		return nil, err
 	}
 
+	opt = applyOptionsDirectives(splitLines(text), opt)
+	return process(text, opt), nil
+}
+
+// render formats Markdown text.
+func render(text []byte, opt *Options) []byte {
 	// extensions for GitHub Flavored Markdown-like parsing.
-	const extensions = blackfriday.EXTENSION_NO_INTRA_EMPHASIS |
+	extensions := blackfriday.EXTENSION_NO_INTRA_EMPHASIS |
 		blackfriday.EXTENSION_TABLES |
 		blackfriday.EXTENSION_FENCED_CODE |
 		blackfriday.EXTENSION_AUTOLINK |
 		blackfriday.EXTENSION_STRIKETHROUGH |
 		blackfriday.EXTENSION_SPACE_HEADERS |
 		blackfriday.EXTENSION_NO_EMPTY_LINE_BEFORE_BLOCK
+	if opt != nil && opt.DefinitionLists {
+		extensions |= blackfriday.EXTENSION_DEFINITION_LISTS
+	}
+	if opt != nil && (opt.HeaderIDs || opt.AutoHeaderIDs) {
+		extensions |= blackfriday.EXTENSION_HEADER_IDS
+	}
+	if opt != nil && opt.AutoHeaderIDs {
+		extensions |= blackfriday.EXTENSION_AUTO_HEADER_IDS
+	}
+	if opt != nil && opt.TitleBlock {
+		extensions |= blackfriday.EXTENSION_TITLEBLOCK
+	}
 
-	output := blackfriday.Markdown(text, NewRenderer(opt), extensions)
-	return output, nil
+	return blackfriday.Markdown(separateKeepSortedDirectives(text), NewRenderer(opt), extensions)
 }
 
 // If src != nil, readSource returns src.
@@ -6,11 +6,12 @@ import (
 	"io/ioutil"
 	"log"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 
+	"github.com/shurcooL/markdownfmt/internal/diff"
 	"github.com/shurcooL/markdownfmt/markdown"
 )
 
@@ -83,6 +84,21 @@ How about ` + "`this`" + ` and other stuff like *italic*, **bold** and ***super
 
 var updateFlag = flag.Bool("update", false, "Update golden files.")
 
+// testOptions maps names of golden tests to options they're processed with.
+// Tests not listed here use the defaults.
+var testOptions = map[string]*markdown.Options{
+	"deflist":           {DefinitionLists: true},
+	"headerids":         {HeaderIDs: true},
+	"autoheaderids":     {AutoHeaderIDs: true},
+	"titleblock":        {TitleBlock: true},
+	"pandoc":            {Pandoc: true},
+	"tablecompact":      {CompactTables: true},
+	"tablemaxwidth":     {MaxTableColumnWidth: 20},
+	"widecharambiguous": {EastAsianAmbiguousWidth: 2},
+	"listindent":        {ListIndent: 2},
+	"wrap":              {WrapWidth: 40},
+}
+
 func Test(t *testing.T) {
 	fis, err := ioutil.ReadDir("testdata")
 	if err != nil {
@@ -94,7 +110,7 @@ func Test(t *testing.T) {
 		}
 		name := strings.TrimSuffix(fi.Name(), ".in.md")
 		t.Run(name, func(t *testing.T) {
-			got, err := markdown.Process(filepath.Join("testdata", name+".in.md"), nil, nil)
+			got, err := markdown.Process(filepath.Join("testdata", name+".in.md"), nil, testOptions[name])
 			if err != nil {
 				t.Fatal("markdown.Process:", err)
 			}
@@ -111,10 +127,7 @@ func Test(t *testing.T) {
 				t.Fatal(err)
 			}
 
-			diff, err := diff(got, want)
-			if err != nil {
-				t.Fatal(err)
-			}
+			diff := diff.Unified(name+".golden.md", name+".golden.md", want, got, diff.Options{Context: 3})
 			if len(diff) != 0 {
 				t.Errorf("difference of %d lines:\n%s", bytes.Count(diff, []byte("\n")), string(diff))
 			}
@@ -122,30 +135,55 @@ func Test(t *testing.T) {
 	}
 }
 
-// TODO: Factor out.
-func diff(b1, b2 []byte) (data []byte, err error) {
-	f1, err := ioutil.TempFile("", "markdownfmt")
+func TestOptionsDirectiveDiagnostics(t *testing.T) {
+	input := []byte(`<!-- markdownfmt: pandoc line-length=80 title-block=maybe east-asian-ambiguous-width=3 -->
+
+Text.
+
+<!-- markdownfmt: wrap=80 -->
+
+<!-- markdownfmt: sort-table -->
+| A |
+|---|
+| 1 |
+
+` + "```" + `
+<!-- markdownfmt: wrap=80 -->
+` + "```" + `
+`)
+	var got []string
+	_, err := markdown.Process("", input, &markdown.Options{
+		Report: func(d markdown.Diagnostic) { got = append(got, d.String()) },
+	})
 	if err != nil {
-		return
+		t.Fatal(err)
+	}
+	want := []string{
+		`1: unknown option "line-length" in markdownfmt directive`,
+		`1: invalid value "maybe" for option "title-block" in markdownfmt directive`,
+		`1: invalid value "3" for option "east-asian-ambiguous-width" in markdownfmt directive`,
+		"5: markdownfmt directive isn't at the top of the document; it's ignored",
 	}
-	defer os.Remove(f1.Name())
-	defer f1.Close()
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
 
-	f2, err := ioutil.TempFile("", "markdownfmt")
+func TestGoCodeDiagnostics(t *testing.T) {
+	input := []byte("Text.\n\n```Go\nfunc f() {\n\treturn 1 +\n}\n```\n\n```go\nfunc g()  {}\n```\n\n" +
+		"```go {.x}\nnot formatted as Go\n```\n\n``` { go }\nfunc h() {\n```\n")
+	var got []string
+	_, err := markdown.Process("", input, &markdown.Options{
+		Report: func(d markdown.Diagnostic) { got = append(got, d.String()) },
+	})
 	if err != nil {
-		return
+		t.Fatal(err)
 	}
-	defer os.Remove(f2.Name())
-	defer f2.Close()
-
-	f1.Write(b1)
-	f2.Write(b2)
-
-	data, err = exec.Command("diff", "-u", f1.Name(), f2.Name()).CombinedOutput()
-	if len(data) > 0 {
-		// diff exits with a non-zero status when the files don't match.
-		// Ignore that failure as long as we get output.
-		err = nil
+	want := []string{
+		"6: Go code block isn't formatted: expected operand, found '}'",
+		"18: Go code block isn't formatted: expected '}', found 'EOF'",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
 	}
-	return
 }
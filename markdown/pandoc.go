@@ -0,0 +1,210 @@
+package markdown
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// attributes are Pandoc attributes, as in {#id .class key=val}.
+type attributes struct {
+	id      string
+	classes []string
+	keyvals [][2]string
+}
+
+// parseAttributes parses the contents of a Pandoc attribute block s
+// (without the surrounding braces). It reports whether s is a valid,
+// non-empty attribute block.
+func parseAttributes(s string) (attrs attributes, ok bool) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return attributes{}, false
+	}
+	for s != "" {
+		end := strings.IndexAny(s, " \t\n")
+		if end == -1 {
+			end = len(s)
+		}
+		switch {
+		case s[0] == '#' && end > 1:
+			attrs.id = s[1:end]
+		case s[0] == '.' && end > 1:
+			attrs.classes = append(attrs.classes, s[1:end])
+		case strings.Index(s[:end], "=") > 0:
+			eq := strings.Index(s, "=")
+			key, rest := s[:eq], s[eq+1:]
+			var val string
+			if strings.HasPrefix(rest, `"`) {
+				q := strings.Index(rest[1:], `"`)
+				if q == -1 {
+					return attributes{}, false
+				}
+				val, end = rest[1:1+q], eq+1+q+2
+			} else {
+				val = s[eq+1 : end]
+			}
+			attrs.keyvals = append(attrs.keyvals, [2]string{key, val})
+		default:
+			return attributes{}, false
+		}
+		s = strings.TrimLeft(s[end:], " \t\n")
+	}
+	return attrs, true
+}
+
+// singleClass returns the only class of attrs, if it has nothing but a single class.
+func (attrs attributes) singleClass() (class string, ok bool) {
+	if attrs.id != "" || len(attrs.classes) != 1 || len(attrs.keyvals) != 0 {
+		return "", false
+	}
+	return attrs.classes[0], true
+}
+
+// String returns the attribute block in normalized form: the identifier first,
+// then classes and key-value pairs in their original order.
+func (attrs attributes) String() string {
+	var fields []string
+	if attrs.id != "" {
+		fields = append(fields, "#"+attrs.id)
+	}
+	for _, class := range attrs.classes {
+		fields = append(fields, "."+class)
+	}
+	for _, kv := range attrs.keyvals {
+		val := kv[1]
+		if val == "" || strings.ContainsAny(val, " \t\"{}") {
+			val = strconv.Quote(val)
+		}
+		fields = append(fields, kv[0]+"="+val)
+	}
+	return "{" + strings.Join(fields, " ") + "}"
+}
+
+// trailingAttributes splits a trailing Pandoc attribute block off text.
+func trailingAttributes(text string) (rest string, attrs attributes, ok bool) {
+	if !strings.HasSuffix(text, "}") {
+		return text, attributes{}, false
+	}
+	start := strings.LastIndex(text, "{")
+	if start == -1 || (start > 0 && text[start-1] == '\\') {
+		return text, attributes{}, false
+	}
+	attrs, ok = parseAttributes(text[start+1 : len(text)-1])
+	if !ok {
+		return text, attributes{}, false
+	}
+	return strings.TrimRight(text[:start], " "), attrs, true
+}
+
+// leadingAttributes splits a leading Pandoc attribute block off text.
+func leadingAttributes(text string) (attrs attributes, rest string, ok bool) {
+	if !strings.HasPrefix(text, "{") {
+		return attributes{}, text, false
+	}
+	end := strings.Index(text, "}")
+	if end == -1 {
+		return attributes{}, text, false
+	}
+	attrs, ok = parseAttributes(text[1:end])
+	if !ok {
+		return attributes{}, text, false
+	}
+	return attrs, text[end+1:], true
+}
+
+var divFenceRE = regexp.MustCompile(`^(:{3,})[ \t]*(.*?)[ \t]*:*[ \t]*$`)
+
+// writePandocBlocks formats lines that may contain Pandoc fenced divs.
+// The content of each div is formatted separately, and the div fences
+// are written with their attributes normalized.
+func writePandocBlocks(out *bytes.Buffer, lines [][]byte, references []byte, opt *Options) {
+	writeDivContent(out, lines, 0, len(lines), closingDivFences(lines), references, opt)
+}
+
+// writeDivContent formats lines[start:end], the content of a div or of the
+// document, where closing gives the closing fence of each div as returned
+// by closingDivFences.
+func writeDivContent(out *bytes.Buffer, lines [][]byte, start, end int, closing []int, references []byte, opt *Options) {
+	var chunk []byte
+	flush := func() {
+		if len(bytes.TrimSpace(chunk)) != 0 {
+			// A chunk of only reference definitions renders as nothing.
+			if res := render(append(chunk, references...), opt); len(res) != 0 {
+				doubleSpace(out)
+				out.Write(res)
+			}
+		}
+		chunk = nil
+	}
+
+	for i := start; i < end; i++ {
+		if closing[i] == -1 {
+			// Not a div, or an unclosed one, which is left as text.
+			chunk = append(chunk, lines[i]...)
+			continue
+		}
+		attrs, _ := openingDivFence(lines[i])
+		flush()
+		doubleSpace(out)
+		if class, ok := attrs.singleClass(); ok {
+			out.WriteString("::: " + class + "\n")
+		} else {
+			out.WriteString("::: " + attrs.String() + "\n")
+		}
+		var inner bytes.Buffer
+		writeDivContent(&inner, lines, i+1, closing[i], closing, references, opt)
+		out.Write(inner.Bytes())
+		out.WriteString(":::\n")
+		i = closing[i]
+	}
+	flush()
+}
+
+// closingDivFences returns for each line the index of the line closing the div
+// that it opens, or -1 if it doesn't open a div that is closed. Each closing
+// fence closes the nearest div before it that isn't closed yet.
+func closingDivFences(lines [][]byte) []int {
+	closing := make([]int, len(lines))
+	var open []int // Indexes of the opening fences of the divs not closed yet.
+	inCodeBlock := codeBlockLines(lines)
+	for i, line := range lines {
+		closing[i] = -1
+		switch {
+		case inCodeBlock[i]:
+		case isClosingDivFence(line):
+			if len(open) != 0 {
+				closing[open[len(open)-1]] = i
+				open = open[:len(open)-1]
+			}
+		default:
+			if _, ok := openingDivFence(line); ok {
+				open = append(open, i)
+			}
+		}
+	}
+	return closing
+}
+
+// openingDivFence reports whether line opens a fenced div, and returns its attributes.
+func openingDivFence(line []byte) (attrs attributes, ok bool) {
+	m := divFenceRE.FindSubmatch(bytes.TrimRight(line, "\n"))
+	if m == nil || len(m[2]) == 0 {
+		return attributes{}, false
+	}
+	info := string(m[2])
+	if strings.HasPrefix(info, "{") && strings.HasSuffix(info, "}") {
+		return parseAttributes(info[1 : len(info)-1])
+	}
+	if strings.ContainsAny(info, " \t{}") {
+		return attributes{}, false
+	}
+	return attributes{classes: []string{info}}, true
+}
+
+// isClosingDivFence reports whether line is a fence without attributes.
+func isClosingDivFence(line []byte) bool {
+	m := divFenceRE.FindSubmatch(bytes.TrimRight(line, "\n"))
+	return m != nil && len(m[2]) == 0
+}
@@ -0,0 +1,53 @@
+package markdown
+
+import (
+	"strings"
+
+	"github.com/mattn/go-runewidth"
+	"github.com/rivo/uniseg"
+)
+
+// newStringWidth returns a function that calculates the visual width of a string
+// by extended grapheme cluster, so that emoji sequences, flags and combining marks
+// are counted as the single character they're displayed as. East Asian ambiguous
+// characters are counted as wide if ambiguousWide is set.
+func newStringWidth(ambiguousWide bool) func(s string) (width int) {
+	c := &runewidth.Condition{EastAsianWidth: ambiguousWide}
+	return func(s string) (width int) {
+		g := uniseg.NewGraphemes(s)
+		for g.Next() {
+			width += graphemeWidth(c, g.Runes())
+		}
+		return width
+	}
+}
+
+// graphemeWidth returns the visual width of a grapheme cluster.
+func graphemeWidth(c *runewidth.Condition, cluster []rune) int {
+	width := c.RuneWidth(cluster[0])
+	for _, r := range cluster[1:] {
+		switch {
+		case r == '\uFE0F', // Emoji presentation selector.
+			r == '\u20E3', // Combining enclosing keycap.
+			isRegionalIndicator(r) && isRegionalIndicator(cluster[0]): // Flag.
+			width = 2
+		}
+	}
+	return width
+}
+
+func isRegionalIndicator(r rune) bool {
+	return r >= 0x1F1E6 && r <= 0x1F1FF
+}
+
+// terminalStringWidth returns a function that calculates the width of a string
+// with stringWidth, taking into account possible ANSI escape codes
+// (which don't count towards string width).
+func terminalStringWidth(stringWidth func(s string) int) func(s string) (width int) {
+	return func(s string) (width int) {
+		width = stringWidth(s)
+		width -= strings.Count(s, "\x1b[1m") * len("[1m") // HACK, TODO: Find a better way of doing this.
+		width -= strings.Count(s, "\x1b[0m") * len("[0m") // HACK, TODO: Find a better way of doing this.
+		return width
+	}
+}
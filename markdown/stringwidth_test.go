@@ -38,3 +38,28 @@ func TestTerminalStringWidth(t *testing.T) {
 		t.Errorf("got %q, dontWant %q", got, dontWant)
 	}
 }
+
+// Test that width is measured by grapheme cluster.
+func TestGraphemeStringWidth(t *testing.T) {
+	tests := []struct {
+		in            string
+		ambiguousWide bool
+		want          int
+	}{
+		{in: "abc", want: 3},
+		{in: "あああ", want: 6},
+		{in: "cafe\u0301", want: 4},              // Combining acute accent.
+		{in: "👍🏽", want: 2},                      // Skin tone modifier.
+		{in: "👨‍👩‍👧", want: 2},                   // ZWJ sequence.
+		{in: "🇯🇵🇺🇸", want: 4},                    // Flags.
+		{in: "❤️", want: 2},                      // Emoji presentation selector.
+		{in: "1️⃣", want: 2},                     // Keycap.
+		{in: "①α", want: 2},                      // East Asian ambiguous.
+		{in: "①α", ambiguousWide: true, want: 4}, // East Asian ambiguous.
+	}
+	for _, tc := range tests {
+		if got := newStringWidth(tc.ambiguousWide)(tc.in); got != tc.want {
+			t.Errorf("width of %q (ambiguousWide: %v): got %v, want %v", tc.in, tc.ambiguousWide, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package markdown
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var tableDelimiterRowRE = regexp.MustCompile(`^ {0,3}\|?[ \t]*:?-+:?[ \t]*(\|[ \t]*:?-+:?[ \t]*)*\|?[ \t]*$`)
+
+// checkTableRows reports rows of tables in lines that have a different number of cells
+// than their table has columns. Such rows are padded with empty cells, or have their
+// extra cells dropped, when the table is parsed.
+func checkTableRows(lines [][]byte, first int, opt *Options) {
+	if opt == nil || opt.Report == nil {
+		return
+	}
+	inCodeBlock := codeBlockLines(lines)
+	for i := 1; i < len(lines); i++ {
+		if inCodeBlock[i-1] || inCodeBlock[i] {
+			continue
+		}
+		columns := tableColumns(lines, i-1)
+		if columns == 0 {
+			continue
+		}
+		for i++; i < len(lines) && !inCodeBlock[i] && bytes.Contains(lines[i], []byte("|")); i++ {
+			if cells := len(tableRowCells(lines[i])); cells != columns {
+				report(opt, Diagnostic{Line: first + i + 1, Message: raggedRowMessage(cells, columns)})
+			}
+		}
+	}
+}
+
+// tableColumns returns the number of columns of the table that starts with
+// the header row lines[i], or 0 if there is no table there.
+func tableColumns(lines [][]byte, i int) int {
+	if i+1 >= len(lines) || !bytes.Contains(lines[i], []byte("|")) ||
+		!tableDelimiterRowRE.Match(bytes.TrimRight(lines[i+1], "\n")) {
+		return 0
+	}
+	columns := len(tableRowCells(lines[i]))
+	if len(tableRowCells(lines[i+1])) != columns {
+		return 0
+	}
+	return columns
+}
+
+func raggedRowMessage(cells, columns int) string {
+	if cells < columns {
+		return fmt.Sprintf("table row has %d cells, but the table has %d columns; it's padded with empty cells", cells, columns)
+	}
+	return fmt.Sprintf("table row has %d cells, but the table has %d columns; the extra cells are dropped", cells, columns)
+}
+
+// tableRowCells splits a table row into cells at pipes that aren't escaped.
+// Leading and trailing pipes don't separate cells.
+func tableRowCells(line []byte) [][]byte {
+	line = bytes.TrimSpace(line)
+	var cells [][]byte
+	start := 0
+	for i := 0; i < len(line); i++ {
+		switch {
+		case line[i] == '\\':
+			i++ // Skip the escaped character.
+		case line[i] == '|':
+			if i != 0 {
+				cells = append(cells, line[start:i])
+			}
+			start = i + 1
+		}
+	}
+	if start < len(line) {
+		cells = append(cells, line[start:])
+	}
+	return cells
+}
+
+// tableSort is a request to sort the body rows of a table, made with a directive
+// right before the table, such as:
+//
+//	<!-- markdownfmt: sort-table column=2 order=desc -->
+type tableSort struct {
+	column int // Column to sort by, starting at 1.
+	desc   bool
+}
+
+var sortTableDirectiveRE = regexp.MustCompile(`^<!--\s*markdownfmt:\s*sort-table(\s.*?)?\s*-->\s*$`)
+
+// parseSortTableDirective parses text as a sort-table directive.
+// ok reports whether text is one, even if it's invalid.
+func parseSortTableDirective(text []byte) (_ tableSort, ok bool, err error) {
+	m := sortTableDirectiveRE.FindSubmatch(text)
+	if m == nil {
+		return tableSort{}, false, nil
+	}
+	s := tableSort{column: 1}
+	for _, setting := range strings.Fields(string(m[1])) {
+		eq := strings.Index(setting, "=")
+		if eq == -1 {
+			return tableSort{}, true, fmt.Errorf("invalid setting %q in sort-table directive", setting)
+		}
+		switch key, value := setting[:eq], setting[eq+1:]; key {
+		case "column":
+			column, err := strconv.Atoi(value)
+			if err != nil || column < 1 {
+				return tableSort{}, true, fmt.Errorf("invalid column %q in sort-table directive", value)
+			}
+			s.column = column
+		case "order":
+			switch value {
+			case "asc":
+				s.desc = false
+			case "desc":
+				s.desc = true
+			default:
+				return tableSort{}, true, fmt.Errorf("invalid order %q in sort-table directive", value)
+			}
+		default:
+			return tableSort{}, true, fmt.Errorf("unknown setting %q in sort-table directive", key)
+		}
+	}
+	return s, true, nil
+}
+
+// checkSortTableDirectives reports sort-table directives in lines that are invalid,
+// aren't followed by a table, or sort by a column that their table doesn't have.
+func checkSortTableDirectives(lines [][]byte, first int, opt *Options) {
+	if opt == nil || opt.Report == nil {
+		return
+	}
+	inCodeBlock := codeBlockLines(lines)
+	for i, line := range lines {
+		if inCodeBlock[i] {
+			continue
+		}
+		s, ok, err := parseSortTableDirective(line)
+		if !ok {
+			continue
+		}
+		table := i + 1
+		for table < len(lines) && isBlank(lines[table]) {
+			table++
+		}
+		d := Diagnostic{Line: first + i + 1}
+		switch columns := tableColumns(lines, table); {
+		case err != nil:
+			d.Message = err.Error()
+		case columns == 0:
+			d.Message = "sort-table directive isn't followed by a table"
+		case s.column > columns:
+			d.Message = fmt.Sprintf("can't sort table by column %d, it has %d columns", s.column, columns)
+		default:
+			continue
+		}
+		report(opt, d)
+	}
+}
+
+// sortTableRows sorts the body rows of the table being rendered.
+// Rows that are equal in the sort column keep their order.
+// Directives that can't be applied are reported by checkSortTableDirectives.
+func (mr *markdownRenderer) sortTableRows(s tableSort) {
+	if s.column > len(mr.headers) {
+		return
+	}
+	sort.SliceStable(mr.rows, func(i, j int) bool {
+		a, b := mr.rows[i][s.column-1], mr.rows[j][s.column-1]
+		if s.desc {
+			a, b = b, a
+		}
+		return naturalLess(a, b)
+	})
+}
+
+// naturalLess reports whether a sorts before b in natural order:
+// runs of digits are compared by their numeric value, and other text
+// is compared case-insensitively, with case only breaking ties.
+func naturalLess(a, b string) bool {
+	if c := naturalCompare(a, b, true); c != 0 {
+		return c < 0
+	}
+	return naturalCompare(a, b, false) < 0
+}
+
+func naturalCompare(a, b string, foldCase bool) int {
+	for a != "" && b != "" {
+		ca, na := nextNaturalChunk(a)
+		cb, nb := nextNaturalChunk(b)
+		a, b = a[len(ca):], b[len(cb):]
+		if na && nb {
+			if c := compareNumbers(ca, cb); c != 0 {
+				return c
+			}
+			continue
+		}
+		if foldCase {
+			ca, cb = strings.ToLower(ca), strings.ToLower(cb)
+		}
+		if c := strings.Compare(ca, cb); c != 0 {
+			return c
+		}
+	}
+	return strings.Compare(a, b) // The one with text left sorts after.
+}
+
+// nextNaturalChunk returns the run of digits or the single non-digit character at the start of s.
+func nextNaturalChunk(s string) (chunk string, number bool) {
+	i := strings.IndexFunc(s, func(r rune) bool { return !unicode.IsDigit(r) })
+	switch i {
+	case 0:
+		_, size := utf8.DecodeRuneInString(s)
+		return s[:size], false
+	case -1:
+		return s, true
+	default:
+		return s[:i], true
+	}
+}
+
+// compareNumbers compares two runs of decimal digits by their numeric value.
+func compareNumbers(a, b string) int {
+	ta, tb := strings.TrimLeft(a, "0"), strings.TrimLeft(b, "0")
+	if len(ta) != len(tb) {
+		if len(ta) < len(tb) {
+			return -1
+		}
+		return 1
+	}
+	if c := strings.Compare(ta, tb); c != 0 {
+		return c
+	}
+	// Fewer leading zeros first.
+	return strings.Compare(b, a)
+}
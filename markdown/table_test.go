@@ -0,0 +1,137 @@
+package markdown
+
+import (
+	"bytes"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestCheckTableRows(t *testing.T) {
+	input := []byte(`| A | B | C |
+|---|---|---|
+| 1 | 2 | 3 |
+| 1 |
+| 1 | 2 \| 3 | 4 | 5 |
+
+` + "```" + `
+| not | a |
+|-----|---|
+| table |
+` + "```" + `
+`)
+	var got []Diagnostic
+	_, err := Process("", input, &Options{Report: func(d Diagnostic) { got = append(got, d) }})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Diagnostic{
+		{Line: 4, Message: "table row has 1 cells, but the table has 3 columns; it's padded with empty cells"},
+		{Line: 5, Message: "table row has 4 cells, but the table has 3 columns; the extra cells are dropped"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+// Test that rows of a table rendered without blackfriday's help
+// are padded or truncated to the number of columns, rather than causing a panic.
+func TestTableRaggedRows(t *testing.T) {
+	var diagnostics int
+	r := NewRenderer(&Options{Report: func(Diagnostic) { diagnostics++ }}).(*markdownRenderer)
+	var buf bytes.Buffer
+	r.TableHeaderCell(&buf, []byte("A"), 0)
+	r.TableHeaderCell(&buf, []byte("B"), 0)
+	r.TableRow(&buf, nil)
+	r.TableCell(&buf, []byte("1"), 0)
+	r.TableRow(&buf, nil)
+	r.TableCell(&buf, []byte("1"), 0)
+	r.TableCell(&buf, []byte("2"), 0)
+	r.TableCell(&buf, []byte("3"), 0)
+	r.TableRow(&buf, nil)
+	r.Table(&buf, nil, nil, nil)
+	want := `| A | B |
+|---|---|
+| 1 |   |
+| 1 | 2 |
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+	if diagnostics != 2 {
+		t.Errorf("got %v diagnostics, want 2", diagnostics)
+	}
+
+	// A table without headers.
+	buf.Reset()
+	r.TableCell(&buf, []byte("1"), 0)
+	r.TableCell(&buf, []byte("2"), 0)
+	r.Table(&buf, nil, nil, nil)
+	want = `|   |   |
+|---|---|
+| 1 | 2 |
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func FuzzTable(f *testing.F) {
+	for _, seed := range []string{
+		"| A | B |\n|---|---|\n| 1 | 2 |\n",
+		"A | B\n:-|-:\n1\n1 | 2 | 3\n",
+		"| A |\n|:-:|\n| \\| | `a\\|b` |\n",
+		"|\n|-|\n||\n",
+		"| ✅ | 🇯🇵 |\n|---|---|\n| x |\n",
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, input string) {
+		output, err := Process("", []byte(input), &Options{Report: func(Diagnostic) {}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Process("", append([]byte{}, output...), nil); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestSortTableDirectiveDiagnostics(t *testing.T) {
+	input := []byte(`<!-- markdownfmt: sort-table column=3 -->
+| A | B |
+|---|---|
+| 2 | 1 |
+
+<!-- markdownfmt: sort-table order=up -->
+| A | B |
+|---|---|
+| 2 | 1 |
+
+<!-- markdownfmt: sort-table -->
+
+Not a table.
+`)
+	var got []string
+	_, err := Process("", input, &Options{Report: func(d Diagnostic) { got = append(got, d.String()) }})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"1: can't sort table by column 3, it has 2 columns",
+		`6: invalid order "up" in sort-table directive`,
+		"11: sort-table directive isn't followed by a table",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestNaturalLess(t *testing.T) {
+	want := []string{"", "a", "A2", "a10", "a010", "B", "b1", "item 9", "Item 10", "v0.4.7", "v1.6.0"}
+	got := append([]string(nil), want...)
+	sort.Slice(got, func(i, j int) bool { return naturalLess(got[i], got[j]) })
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
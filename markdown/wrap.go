@@ -0,0 +1,109 @@
+package markdown
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+)
+
+// wrapMark marks the spaces where lines may be wrapped, until the document
+// is rendered and the indentation of its lines is known.
+const wrapMark = '\x1f'
+
+// blockStartRE matches words that could start a block other than a paragraph,
+// or continue one, if a line started with them.
+var blockStartRE = regexp.MustCompile("^([-+*>#=:|<~`]|[0-9]+[.)]$|\\[[^\\]]*\\]:)")
+
+// markBreaks marks the spaces of b at the given positions that a line
+// can be wrapped at.
+func markBreaks(b []byte, spaces []int) {
+	for _, space := range spaces {
+		if space < len(b) && b[space] == ' ' && canStartLine(b[space+1:]) {
+			b[space] = wrapMark
+		}
+	}
+}
+
+// wrapLines wraps the lines of the rendered document b at its marked spaces,
+// so that lines fit in WrapWidth where possible. Continuation lines get
+// the block quote markers and indentation of the line they continue.
+func (mr *markdownRenderer) wrapLines(b []byte) []byte {
+	if bytes.IndexByte(b, wrapMark) == -1 {
+		return b
+	}
+	var out []byte
+	for _, line := range bytes.SplitAfter(b, []byte("\n")) {
+		if bytes.IndexByte(line, wrapMark) == -1 {
+			out = append(out, line...)
+			continue
+		}
+		newline := bytes.HasSuffix(line, []byte("\n"))
+		words := bytes.Split(bytes.TrimSuffix(line, []byte("\n")), []byte{wrapMark})
+		prefix := continuationPrefix(words[0])
+		lineStart := len(out)
+		out = append(out, words[0]...)
+		for _, word := range words[1:] {
+			space := len(out)
+			out = append(out, ' ')
+			out = append(out, word...)
+			if mr.columnWidth(out[lineStart:]) > mr.opt.WrapWidth {
+				out = append(out[:space], '\n')
+				out = append(out, prefix...)
+				out = append(out, word...)
+				lineStart = space + 1
+			}
+		}
+		if newline {
+			out = append(out, '\n')
+		}
+	}
+	return out
+}
+
+var listMarkerRE = regexp.MustCompile(`^([-+*:]|[0-9]+[.)])[ \t]`)
+
+// continuationPrefix returns the block quote markers and indentation that
+// lines continuing line start with, with its list markers replaced by indentation.
+func continuationPrefix(line []byte) []byte {
+	var prefix []byte
+	for len(line) != 0 {
+		if c := line[0]; c == ' ' || c == '\t' || c == '>' {
+			prefix = append(prefix, c)
+			line = line[1:]
+			continue
+		}
+		m := listMarkerRE.Find(line)
+		if m == nil {
+			break
+		}
+		if m[len(m)-1] == '\t' {
+			prefix = append(prefix, '\t')
+		} else {
+			prefix = append(prefix, bytes.Repeat([]byte(" "), len(m))...)
+		}
+		line = line[len(m):]
+	}
+	return prefix
+}
+
+// columnWidth returns the width of line, with tabs expanded to multiples of 4 columns.
+func (mr *markdownRenderer) columnWidth(line []byte) int {
+	width := 0
+	for i, s := range strings.Split(string(line), "\t") {
+		if i > 0 {
+			width += 4 - width%4
+		}
+		width += mr.stringWidth(s)
+	}
+	return width
+}
+
+// canStartLine reports whether a line of a paragraph can start with text
+// without changing the meaning of the document.
+func canStartLine(text []byte) bool {
+	word := text
+	if i := bytes.IndexAny(text, " \n"+string(wrapMark)); i != -1 {
+		word = text[:i]
+	}
+	return len(word) != 0 && !blockStartRE.Match(word)
+}
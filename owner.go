@@ -0,0 +1,18 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// chown gives the file name the owner and group of fi.
+func chown(name string, fi os.FileInfo) error {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+	return os.Chown(name, int(st.Uid), int(st.Gid))
+}
@@ -0,0 +1,11 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package main
+
+import "os"
+
+// chown does nothing, since files don't have owners that can be kept.
+func chown(name string, fi os.FileInfo) error {
+	return nil
+}
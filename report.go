@@ -0,0 +1,277 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/shurcooL/markdownfmt/internal/diff"
+	"github.com/shurcooL/markdownfmt/markdown"
+)
+
+// fileReport is what -format reports about a file: the lines that
+// formatting changes and the diagnostics found in it.
+type fileReport struct {
+	File        string       `json:"file"`
+	Changes     []lineRange  `json:"changes,omitempty"`
+	Diagnostics []diagnostic `json:"diagnostics,omitempty"`
+}
+
+// lineRange is a range of lines of a file, numbered from 1, including End.
+type lineRange struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+type diagnostic struct {
+	Line    int    `json:"line,omitempty"` // 0 if unknown.
+	Message string `json:"message"`
+}
+
+// changedMessage is the message of reports of changed lines.
+const changedMessage = "formatting differs from markdownfmt's"
+
+// The reports of -format, for files with changes or diagnostics.
+var (
+	reports   []fileReport
+	reportsMu sync.Mutex
+)
+
+// addReport adds the report of the file filename, whose formatting changes
+// src to res, if there is something to report.
+func addReport(filename string, src, res []byte, diagnostics []markdown.Diagnostic) {
+	r := fileReport{File: filename, Changes: changedLines(src, res)}
+	for _, d := range diagnostics {
+		r.Diagnostics = append(r.Diagnostics, diagnostic{Line: d.Line, Message: d.Message})
+	}
+	if r.Changes == nil && r.Diagnostics == nil {
+		return
+	}
+	reportsMu.Lock()
+	reports = append(reports, r)
+	reportsMu.Unlock()
+}
+
+// changedLines returns the ranges of lines of old that are changed in new.
+// Lines only inserted are reported as a change of the line after them,
+// or of the last line at the end.
+func changedLines(old, new []byte) []lineRange {
+	last := bytes.Count(old, []byte("\n"))
+	if len(old) != 0 && old[len(old)-1] != '\n' {
+		last++
+	}
+	var ranges []lineRange
+	changing := false
+	for _, e := range diff.Lines(old, new) {
+		switch {
+		case e.Op == diff.Equal:
+			changing = false
+		case !changing:
+			line := e.Old + 1
+			if line > last && last != 0 {
+				line = last
+			}
+			ranges = append(ranges, lineRange{Start: line, End: line})
+			changing = true
+		case e.Op == diff.Delete:
+			ranges[len(ranges)-1].End = e.Old + 1
+		}
+	}
+	return ranges
+}
+
+// reportFormats are the formats of -format, keyed by name.
+var reportFormats = map[string]func(w io.Writer, reports []fileReport) error{
+	"json":       writeJSONReport,
+	"sarif":      writeSARIFReport,
+	"github":     writeGitHubReport,
+	"checkstyle": writeCheckstyleReport,
+}
+
+// writeReport writes the reports in the format of -format, sorted by file.
+func writeReport(w io.Writer) {
+	sort.SliceStable(reports, func(i, j int) bool { return reports[i].File < reports[j].File })
+	if err := reportFormats[*format](w, reports); err != nil {
+		report(err)
+	}
+}
+
+func writeJSONReport(w io.Writer, reports []fileReport) error {
+	if reports == nil {
+		reports = []fileReport{}
+	}
+	data, err := json.MarshalIndent(reports, "", "\t")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", data)
+	return err
+}
+
+// writeSARIFReport writes a SARIF 2.1.0 log, as used by GitHub code scanning.
+func writeSARIFReport(w io.Writer, reports []fileReport) error {
+	type message struct {
+		Text string `json:"text"`
+	}
+	type region struct {
+		StartLine int `json:"startLine"`
+		EndLine   int `json:"endLine,omitempty"`
+	}
+	type physicalLocation struct {
+		ArtifactLocation struct {
+			URI string `json:"uri"`
+		} `json:"artifactLocation"`
+		Region *region `json:"region,omitempty"`
+	}
+	type location struct {
+		PhysicalLocation physicalLocation `json:"physicalLocation"`
+	}
+	type result struct {
+		RuleID    string     `json:"ruleId"`
+		Level     string     `json:"level"`
+		Message   message    `json:"message"`
+		Locations []location `json:"locations"`
+	}
+	type rule struct {
+		ID               string  `json:"id"`
+		ShortDescription message `json:"shortDescription"`
+	}
+
+	results := []result{}
+	add := func(file, ruleID, level, msg string, r *region) {
+		var loc location
+		loc.PhysicalLocation.ArtifactLocation.URI = fileURI(file)
+		loc.PhysicalLocation.Region = r
+		results = append(results, result{RuleID: ruleID, Level: level, Message: message{msg}, Locations: []location{loc}})
+	}
+	for _, r := range reports {
+		for _, c := range r.Changes {
+			add(r.File, "formatting", "error", changedMessage, &region{StartLine: c.Start, EndLine: c.End})
+		}
+		for _, d := range r.Diagnostics {
+			var reg *region
+			if d.Line != 0 {
+				reg = &region{StartLine: d.Line}
+			}
+			add(r.File, "diagnostic", "warning", d.Message, reg)
+		}
+	}
+
+	type driver struct {
+		Name           string `json:"name"`
+		InformationURI string `json:"informationUri"`
+		Rules          []rule `json:"rules"`
+	}
+	type run struct {
+		Tool struct {
+			Driver driver `json:"driver"`
+		} `json:"tool"`
+		Results []result `json:"results"`
+	}
+	var r run
+	r.Tool.Driver = driver{
+		Name:           "markdownfmt",
+		InformationURI: "https://github.com/shurcooL/markdownfmt",
+		Rules: []rule{
+			{ID: "formatting", ShortDescription: message{"Markdown that isn't formatted by markdownfmt"}},
+			{ID: "diagnostic", ShortDescription: message{"Problem found while formatting Markdown"}},
+		},
+	}
+	r.Results = results
+	log := struct {
+		Version string `json:"version"`
+		Schema  string `json:"$schema"`
+		Runs    []run  `json:"runs"`
+	}{"2.1.0", "https://json.schemastore.org/sarif-2.1.0.json", []run{r}}
+	data, err := json.MarshalIndent(log, "", "\t")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", data)
+	return err
+}
+
+// fileURI returns the URI of the file filename, which is relative
+// if filename is.
+func fileURI(filename string) string {
+	u := url.URL{Path: filepath.ToSlash(filename)}
+	if filepath.IsAbs(filename) {
+		u.Scheme = "file"
+		if !strings.HasPrefix(u.Path, "/") {
+			u.Path = "/" + u.Path // A Windows path.
+		}
+	}
+	return u.String()
+}
+
+// writeGitHubReport writes workflow commands that make GitHub Actions
+// annotate the lines.
+func writeGitHubReport(w io.Writer, reports []fileReport) error {
+	escape := strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A")
+	escapeProperty := strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C")
+	for _, r := range reports {
+		file := escapeProperty.Replace(filepath.ToSlash(r.File))
+		for _, c := range r.Changes {
+			if _, err := fmt.Fprintf(w, "::error file=%s,line=%d,endLine=%d,title=markdownfmt::%s\n", file, c.Start, c.End, escape.Replace(changedMessage)); err != nil {
+				return err
+			}
+		}
+		for _, d := range r.Diagnostics {
+			line := ""
+			if d.Line != 0 {
+				line = fmt.Sprintf(",line=%d", d.Line)
+			}
+			if _, err := fmt.Fprintf(w, "::warning file=%s%s,title=markdownfmt::%s\n", file, line, escape.Replace(d.Message)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writeCheckstyleReport writes a report in the XML format of Checkstyle.
+func writeCheckstyleReport(w io.Writer, reports []fileReport) error {
+	type checkstyleError struct {
+		Line     int    `xml:"line,attr,omitempty"`
+		Severity string `xml:"severity,attr"`
+		Message  string `xml:"message,attr"`
+		Source   string `xml:"source,attr"`
+	}
+	type checkstyleFile struct {
+		Name   string            `xml:"name,attr"`
+		Errors []checkstyleError `xml:"error"`
+	}
+	var doc struct {
+		XMLName xml.Name         `xml:"checkstyle"`
+		Version string           `xml:"version,attr"`
+		Files   []checkstyleFile `xml:"file"`
+	}
+	doc.Version = "4.3"
+	for _, r := range reports {
+		f := checkstyleFile{Name: r.File}
+		for _, c := range r.Changes {
+			msg := fmt.Sprintf("%s (lines %d-%d)", changedMessage, c.Start, c.End)
+			if c.Start == c.End {
+				msg = changedMessage
+			}
+			f.Errors = append(f.Errors, checkstyleError{Line: c.Start, Severity: "error", Message: msg, Source: "markdownfmt.formatting"})
+		}
+		for _, d := range r.Diagnostics {
+			f.Errors = append(f.Errors, checkstyleError{Line: d.Line, Severity: "warning", Message: d.Message, Source: "markdownfmt.diagnostic"})
+		}
+		doc.Files = append(doc.Files, f)
+	}
+	data, err := xml.MarshalIndent(doc, "", "\t")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s%s\n", xml.Header, data)
+	return err
+}
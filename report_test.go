@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestChangedLines(t *testing.T) {
+	tests := []struct {
+		old, new string
+		want     []lineRange
+	}{
+		{"a\nb\n", "a\nb\n", nil},
+		{"a\nb\nc\n", "a\nB\nc\n", []lineRange{{2, 2}}},
+		{"a\n\n\n\nb\n", "a\n\nb\n", []lineRange{{3, 4}}},
+		{"a\nb\n", "a\nx\nb\n", []lineRange{{2, 2}}},
+		{"a\nb", "a\nb\n", []lineRange{{2, 2}}},
+		{"a\nb\n", "a\nb\nc\n", []lineRange{{2, 2}}},
+		{"a\nb\nc\nd\n", "A\nb\nc\nD\n", []lineRange{{1, 1}, {4, 4}}},
+		{"", "a\n", []lineRange{{1, 1}}},
+	}
+	for _, tt := range tests {
+		if got := changedLines([]byte(tt.old), []byte(tt.new)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("changedLines(%q, %q): got %v, want %v", tt.old, tt.new, got, tt.want)
+		}
+	}
+}
+
+func TestWriteGitHubReport(t *testing.T) {
+	reports := []fileReport{{
+		File:        "docs/a,b.md",
+		Changes:     []lineRange{{3, 5}},
+		Diagnostics: []diagnostic{{Message: "100% odd\nreally"}, {Line: 7, Message: "bad"}},
+	}}
+	var out bytes.Buffer
+	if err := writeGitHubReport(&out, reports); err != nil {
+		t.Fatal(err)
+	}
+	want := "::error file=docs/a%2Cb.md,line=3,endLine=5,title=markdownfmt::formatting differs from markdownfmt's\n" +
+		"::warning file=docs/a%2Cb.md,title=markdownfmt::100%25 odd%0Areally\n" +
+		"::warning file=docs/a%2Cb.md,line=7,title=markdownfmt::bad\n"
+	if got := out.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// writeFile replaces the content of the file filename with data. It writes
+// to a temporary file in the same directory and renames it over the file,
+// so that the file is never left partially written. The mode and, where
+// possible, the owner of the file are kept, and if filename is a symbolic
+// link, the file it points to is replaced. With -backup, the original file
+// is kept with the suffix added to its name.
+func writeFile(filename string, data []byte) error {
+	target, err := filepath.EvalSymlinks(filename)
+	if err != nil {
+		return err
+	}
+	fi, err := os.Stat(target)
+	if err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(target), "."+filepath.Base(target)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	defer os.Remove(tmp) // Fails once renamed.
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if err1 := f.Close(); err == nil {
+		err = err1
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp, fi.Mode().Perm()); err != nil {
+		return err
+	}
+	chown(tmp, fi) // Only possible for some users, which isn't an error.
+
+	if *backup != "" {
+		if err := backupFile(target, fi); err != nil {
+			return err
+		}
+	}
+	return os.Rename(tmp, target)
+}
+
+// backupFile keeps a copy of the file filename with the -backup suffix
+// added to its name. It's a hard link if possible.
+func backupFile(filename string, fi os.FileInfo) error {
+	name := filename + *backup
+	if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if os.Link(filename, name) == nil {
+		return nil
+	}
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(name, data, fi.Mode().Perm())
+}
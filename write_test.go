@@ -0,0 +1,50 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "markdownfmt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	target := filepath.Join(dir, "a.md")
+	if err := ioutil.WriteFile(target, []byte("old\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(dir, "link.md")
+	if err := os.Symlink("a.md", link); err != nil {
+		t.Skip("symbolic links not supported:", err)
+	}
+
+	defer func(suffix string) { *backup = suffix }(*backup)
+	*backup = "~"
+	if err := writeFile(link, []byte("new\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	if dest, err := os.Readlink(link); err != nil || dest != "a.md" {
+		t.Errorf("got link to %q, %v, want a.md", dest, err)
+	}
+	if data, err := ioutil.ReadFile(target); err != nil || string(data) != "new\n" {
+		t.Errorf("got content %q, %v, want new", data, err)
+	}
+	if fi, err := os.Stat(target); err != nil || fi.Mode().Perm() != 0600 {
+		t.Errorf("got mode %v, %v, want 0600", fi.Mode(), err)
+	}
+	if data, err := ioutil.ReadFile(target + "~"); err != nil || string(data) != "old\n" {
+		t.Errorf("got backup %q, %v, want old", data, err)
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 3 {
+		t.Errorf("got %d files, want a.md, a.md~ and link.md", len(files))
+	}
+}